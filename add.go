@@ -1,29 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 
 	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Add(args []string) {
-	if len(args) < 1 {
+func Add(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("add", flag.ExitOnError)
+	create := flags.Bool("create", false, "create pages on the server from existing untracked files")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
 		log.Fatalln("add sub-command need at least one page id argument")
 	}
 
 	database := LoadDatabase()
-	token := LoadToken()
-
-	client := api.NewClient(database.Config.BaseURL)
-	client.Token = token
+	client := newClient(database)
 
-	for _, id := range args {
-		err := database.addPage(client, id)
-		if err != nil {
+	for i, id := range flags.Args() {
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 interrupted, %d page(s) were not processed\n", len(flags.Args())-i)
+			break
+		}
+		if *create {
+			err := database.createPage(ctx, client, id, true)
+			if errors.Is(err, api.ErrUnauthorized) {
+				unauthorized(ctx, database, client)
+				break
+			} else if errors.Is(err, api.ErrForbidden) {
+				fmt.Printf("🚫 not allowed to create page %q\n", id)
+			} else if err != nil {
+				fmt.Printf("❌ error while creating page %q: %v\n", id, err)
+			} else {
+				fmt.Printf("🌱 created new page %q on server from file %q ", id, database.pagePath(id))
+				fmt.Print(database.Config.BaseURL + "/" + id + "\n")
+			}
+			continue
+		}
+		err := database.addPage(ctx, client, id)
+		if errors.Is(err, api.ErrUnauthorized) {
+			unauthorized(ctx, database, client)
+			break
+		} else if errors.Is(err, api.ErrForbidden) {
+			fmt.Printf("🚫 not allowed to read page %q\n", id)
+		} else if err != nil {
 			fmt.Printf("❌ error while adding page %q: %v\n", id, err)
 		} else {
-			fmt.Printf("⭐️ added new tracked page %q, created new file %q\n", id, GetPagePath(id))
+			fmt.Printf("⭐️ added new tracked page %q, created new file %q\n", id, database.pagePath(id))
 		}
 	}
 
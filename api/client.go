@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,7 +13,6 @@ import (
 	"time"
 )
 
-var ErrConflict = errors.New("conflict")
 var ErrNoResponse = errors.New("no response")
 
 type Options struct {
@@ -50,21 +50,29 @@ type ShortResponse struct {
 	Message string `json:"message"`
 }
 
+// default maximum duration of a request, including reading the response
+const DefaultTimeout = 30 * time.Second
+
 type Client struct {
-	BaseURL string
-	Token   string
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client  // client used to send requests, http.DefaultClient if nil
+	Timeout    time.Duration // maximum duration of a request, or of inactivity for media transfers, no limit if zero
+	Retry      RetryPolicy   // how requests failing because of a transient error are retried
 }
 
 func NewClient(baseURL string) *Client {
 
 	return &Client{
 		BaseURL: strings.TrimRight(baseURL, "/"),
+		Timeout: DefaultTimeout,
+		Retry:   DefaultRetryPolicy,
 	}
 }
 
-func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
 	url := c.BaseURL + path
-	request, err := http.NewRequest(method, url, body)
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -75,41 +83,209 @@ func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request,
 	return request, nil
 }
 
+// Send request, retrying according to client retry policy if retry is true.
+// Request body, if any, must be replayable.
+// If transfer is true, timeout only limits inactivity, see send.
+// Returned bool is true if response comes from a retry: previous attempts may then have been applied by the server.
+// Can send Error of type ErrNoResponse
+func (c *Client) do(request *http.Request, retry bool, transfer bool) (*http.Response, bool, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, true, fmt.Errorf("create request: %w", err)
+			}
+			request.Body = body
+		}
+		res, err := c.send(request, transfer)
+
+		transient := err != nil && request.Context().Err() == nil // not canceled by caller
+		if res != nil {
+			transient = transientStatus(res.StatusCode)
+		}
+		if !retry || !transient || attempt >= c.Retry.MaxRetries {
+			return res, attempt > 0, err
+		}
+
+		delay, ok := c.Retry.delay(attempt+1, res)
+		if !ok {
+			return res, attempt > 0, err
+		}
+		if res != nil {
+			discard(res)
+		}
+		select {
+		case <-time.After(delay):
+		case <-request.Context().Done():
+			return nil, true, fmt.Errorf("%w: %w", ErrNoResponse, request.Context().Err())
+		}
+	}
+}
+
+// Send request once, applying client timeout until response body is closed.
+// For media transfers, timeout is postponed each time data is sent or received,
+// so that large files can take longer, while stalled transfers are still stopped.
 // Can send Error of type ErrNoResponse
-func (c *Client) post(path string, content any) (*http.Response, error) {
+func (c *Client) send(request *http.Request, transfer bool) (*http.Response, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if c.Timeout <= 0 {
+		res, err := httpClient.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNoResponse, err)
+		}
+		return res, nil
+	}
+	if !transfer {
+		ctx, cancel := context.WithTimeout(request.Context(), c.Timeout)
+		res, err := httpClient.Do(request.WithContext(ctx))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("%w: %w", ErrNoResponse, err)
+		}
+		res.Body = &cancelOnClose{res.Body, cancel}
+		return res, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(request.Context())
+	idle := &idleTimer{ctx: ctx, timeout: c.Timeout}
+	idle.timer = time.AfterFunc(c.Timeout, func() {
+		cancel(fmt.Errorf("%w: no data transferred for %s", context.DeadlineExceeded, c.Timeout))
+	})
+	release := func() {
+		idle.timer.Stop()
+		cancel(nil)
+	}
+	request = request.WithContext(ctx)
+	if request.Body != nil {
+		request.Body = &idleReader{request.Body, idle}
+	}
+	res, err := httpClient.Do(request)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("%w: %w", ErrNoResponse, idle.cause(err))
+	}
+	res.Body = &cancelOnClose{&idleReader{res.Body, idle}, release}
+	return res, nil
+}
+
+// response body releasing its request context once closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// timer canceling a media transfer after a period of inactivity
+type idleTimer struct {
+	ctx     context.Context
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// replace error caused by inactivity with a more explicit one
+func (t *idleTimer) cause(err error) error {
+	if cause := context.Cause(t.ctx); errors.Is(cause, context.DeadlineExceeded) {
+		return cause
+	}
+	return err
+}
+
+// body postponing idle timer each time data is read
+type idleReader struct {
+	io.ReadCloser
+	idle *idleTimer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.idle.timer.Reset(r.idle.timeout)
+	}
+	if err != nil && err != io.EOF {
+		err = r.idle.cause(err)
+	}
+	return n, err
+}
+
+// If retry is true, request is sent again in case of transient error,
+// and returned bool tells if response comes from a retry.
+// Can send Error of type ErrNoResponse
+func (c *Client) post(ctx context.Context, path string, content any, retry bool) (*http.Response, bool, error) {
 	buf := &bytes.Buffer{}
 	encoder := json.NewEncoder(buf)
 	if err := encoder.Encode(&content); err != nil {
-		return nil, fmt.Errorf("encode request body: %w", err)
+		return nil, false, fmt.Errorf("encode request body: %w", err)
 	}
-	request, err := c.newRequest(http.MethodPost, path, buf)
+	request, err := c.newRequest(ctx, http.MethodPost, path, buf)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, false, fmt.Errorf("create request: %w", err)
 	}
 	request.Header.Set("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(request)
+	return c.do(request, retry, false)
+}
+
+// Can send Error of type ErrNoResponse
+func (c *Client) get(ctx context.Context, path string) (*http.Response, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrNoResponse, err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
-	return res, nil
+	res, _, err := c.do(request, true, false)
+	return res, err
 }
 
+// Get raw content, like a file.
+// Timeout only limits inactivity, as content can be large.
 // Can send Error of type ErrNoResponse
-func (c *Client) get(path string) (*http.Response, error) {
-	request, err := c.newRequest(http.MethodGet, path, nil)
+func (c *Client) getRaw(ctx context.Context, path string) (*http.Response, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	res, err := http.DefaultClient.Do(request)
+	res, _, err := c.do(request, true, true)
+	return res, err
+}
+
+// Returned bool tells if response comes from a retry.
+// Can send Error of type ErrNoResponse
+func (c *Client) delete(ctx context.Context, path string) (*http.Response, bool, error) {
+	request, err := c.newRequest(ctx, http.MethodDelete, path, nil)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrNoResponse, err)
+		return nil, false, fmt.Errorf("create request: %w", err)
 	}
-	return res, nil
+	return c.do(request, true, false)
 }
 
+// Send raw content, like a file.
+// As content is read only once, request is never retried.
+// Timeout only limits inactivity, as content can be large.
+// Can send Error of type ErrNoResponse
+func (c *Client) postRaw(ctx context.Context, path string, content io.Reader) (*http.Response, error) {
+	request, err := c.newRequest(ctx, http.MethodPost, path, content)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	res, _, err := c.do(request, false, true)
+	return res, err
+}
+
+// Get is GetContext with a background context
 func (c *Client) Get(id string) (*Page, error) {
+	return c.GetContext(context.Background(), id)
+}
+
+// if page does not exist, returned error is ErrNotFound
+func (c *Client) GetContext(ctx context.Context, id string) (*Page, error) {
 	path := fmt.Sprint("/api/v0/page/", id)
-	res, err := c.get(path)
+	res, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
@@ -127,9 +303,14 @@ func (c *Client) Get(id string) (*Page, error) {
 	return &page, nil
 }
 
+// Update is UpdateContext with a background context
+func (c *Client) Update(page *Page, force bool) (*Page, error) {
+	return c.UpdateContext(context.Background(), page, force)
+}
+
 // try to update page
 // if response is 409, returned error is ErrConflict
-func (c *Client) Update(page *Page, force bool) (*Page, error) {
+func (c *Client) UpdateContext(ctx context.Context, page *Page, force bool) (*Page, error) {
 	var query string
 	if force {
 		v := url.Values{}
@@ -137,13 +318,21 @@ func (c *Client) Update(page *Page, force bool) (*Page, error) {
 		query = "?" + v.Encode()
 	}
 	path := fmt.Sprint("/api/v0/page/", page.ID, "/update", query)
-	res, err := c.post(path, page)
+	// without force, update is rejected if page changed since DateModif, so sending it again is safe
+	res, retried, err := c.post(ctx, path, page, !force)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if err := chekResponse(res); err != nil {
+		// a previous attempt may have been applied without its response being received,
+		// making the retry conflict with it
+		if retried && errors.Is(err, ErrConflict) {
+			if current, getErr := c.GetContext(ctx, page.ID); getErr == nil && sameFields(page, current) {
+				return current, nil
+			}
+		}
 		return nil, err
 	}
 
@@ -155,8 +344,65 @@ func (c *Client) Update(page *Page, force bool) (*Page, error) {
 	return &updatedPage, nil
 }
 
+// Add is AddContext with a background context
+func (c *Client) Add(page *Page) (*Page, error) {
+	return c.AddContext(context.Background(), page)
+}
+
+// create a new page on the server
+// if a page with the same ID already exist, returned error is ErrConflict
+func (c *Client) AddContext(ctx context.Context, page *Page) (*Page, error) {
+	if err := ValidateID(page.ID); err != nil {
+		return nil, err
+	}
+	path := fmt.Sprint("/api/v0/page/", page.ID, "/add")
+	res, _, err := c.post(ctx, path, page, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := chekResponse(res); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	var addedPage Page
+	if err := decoder.Decode(&addedPage); err != nil {
+		return nil, fmt.Errorf("decode added page: %w", err)
+	}
+	return &addedPage, nil
+}
+
+// Delete is DeleteContext with a background context
+func (c *Client) Delete(id string) error {
+	return c.DeleteContext(context.Background(), id)
+}
+
+// delete page on the server
+// if page does not exist, returned error is ErrNotFound
+func (c *Client) DeleteContext(ctx context.Context, id string) error {
+	path := fmt.Sprint("/api/v0/page/", id)
+	res, retried, err := c.delete(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	err = chekResponse(res)
+	if retried && errors.Is(err, ErrNotFound) {
+		return nil // deleted by a previous attempt whose response was lost
+	}
+	return err
+}
+
+// List is ListContext with a background context
 func (c *Client) List() ([]string, error) {
-	res, err := c.get("/api/v0/pages/list")
+	return c.ListContext(context.Background())
+}
+
+func (c *Client) ListContext(ctx context.Context) ([]string, error) {
+	res, err := c.get(ctx, "/api/v0/pages/list")
 	if err != nil {
 		return nil, err
 	}
@@ -176,8 +422,13 @@ func (c *Client) List() ([]string, error) {
 	return list.Pages, nil
 }
 
+// Query is QueryContext with a background context
 func (c *Client) Query(options *Options) (map[string]*Page, error) {
-	res, err := c.post("/api/v0/pages/query", options)
+	return c.QueryContext(context.Background(), options)
+}
+
+func (c *Client) QueryContext(ctx context.Context, options *Options) (map[string]*Page, error) {
+	res, _, err := c.post(ctx, "/api/v0/pages/query", options, true)
 	if err != nil {
 		return nil, err
 	}
@@ -197,7 +448,83 @@ func (c *Client) Query(options *Options) (map[string]*Page, error) {
 	return result.Pages, nil
 }
 
+// MediaList is MediaListContext with a background context
+func (c *Client) MediaList() ([]*Media, error) {
+	return c.MediaListContext(context.Background())
+}
+
+// list all files of the media library, including those in sub-folders
+func (c *Client) MediaListContext(ctx context.Context) ([]*Media, error) {
+	res, err := c.get(ctx, "/api/v0/media/list")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := chekResponse(res); err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Media []*Media `json:"media"`
+	}
+	decoder := json.NewDecoder(res.Body)
+	if err := decoder.Decode(&list); err != nil {
+		return nil, fmt.Errorf("decode media list: %w", err)
+	}
+	return list.Media, nil
+}
+
+// Download is DownloadContext with a background context
+func (c *Client) Download(path string) (io.ReadCloser, error) {
+	return c.DownloadContext(context.Background(), path)
+}
+
+// Download a media file, its content should be closed by caller.
+// If file does not exist, returned error is ErrNotFound
+func (c *Client) DownloadContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	res, err := c.getRaw(ctx, "/media/"+escapeMediaPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if err := chekResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Upload is UploadContext with a background context
+func (c *Client) Upload(path string, content io.Reader) (*Media, error) {
+	return c.UploadContext(context.Background(), path, content)
+}
+
+// upload a media file, replacing existing one
+func (c *Client) UploadContext(ctx context.Context, path string, content io.Reader) (*Media, error) {
+	res, err := c.postRaw(ctx, "/api/v0/media/upload/"+escapeMediaPath(path), content)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := chekResponse(res); err != nil {
+		return nil, err
+	}
+
+	var media Media
+	decoder := json.NewDecoder(res.Body)
+	if err := decoder.Decode(&media); err != nil {
+		return nil, fmt.Errorf("decode uploaded media: %w", err)
+	}
+	return &media, nil
+}
+
+// Auth is AuthContext with a background context
 func (c *Client) Auth(username string, password string) (string, error) {
+	return c.AuthContext(context.Background(), username, password)
+}
+
+func (c *Client) AuthContext(ctx context.Context, username string, password string) (string, error) {
 
 	credentials := struct {
 		Username string `json:"username"`
@@ -207,7 +534,8 @@ func (c *Client) Auth(username string, password string) (string, error) {
 		Password: password,
 	}
 
-	res, err := c.post("/api/v0/auth", credentials)
+	// not retried, as only safe or idempotent requests are
+	res, _, err := c.post(ctx, "/api/v0/auth", credentials, false)
 	if err != nil {
 		return "", err
 	}
@@ -228,8 +556,13 @@ func (c *Client) Auth(username string, password string) (string, error) {
 	return tokenResponse.Token, nil
 }
 
+// Version is VersionContext with a background context
 func (c *Client) Version() (string, error) {
-	res, err := c.get("/api/v0/version")
+	return c.VersionContext(context.Background())
+}
+
+func (c *Client) VersionContext(ctx context.Context) (string, error) {
+	res, err := c.get(ctx, "/api/v0/version")
 	if err != nil {
 		return "", err
 	}
@@ -253,18 +586,13 @@ func (c *Client) Version() (string, error) {
 
 func chekResponse(res *http.Response) error {
 	if res.StatusCode != 200 {
+		apiErr := &Error{StatusCode: res.StatusCode, Path: res.Request.URL.Path}
 		decoder := json.NewDecoder(res.Body)
 		var shortResponse ShortResponse
-		msg := fmt.Sprintf("status code: %d", res.StatusCode)
 		if err := decoder.Decode(&shortResponse); err == nil {
-			msg = fmt.Sprintf("status code: %d - %s", res.StatusCode, shortResponse.Message)
-		}
-		switch res.StatusCode {
-		case 409:
-			return fmt.Errorf("%w: %v", ErrConflict, msg)
-		default:
-			return errors.New(msg)
+			apiErr.Message = shortResponse.Message
 		}
+		return apiErr
 	}
 
 	return nil
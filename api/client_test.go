@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// client of a test server, retrying without waiting
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL)
+	client.Retry = RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+	return client
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int32
+		err      bool
+	}{
+		{"service unavailable", http.StatusServiceUnavailable, 3, false},
+		{"bad gateway", http.StatusBadGateway, 3, false},
+		{"too many requests", http.StatusTooManyRequests, 3, false},
+		{"internal server error", http.StatusInternalServerError, 1, true},
+		{"not found", http.StatusNotFound, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) < 3 {
+					w.WriteHeader(test.status)
+					return
+				}
+				json.NewEncoder(w).Encode(Page{ID: "page"})
+			})
+			_, err := client.Get("page")
+			if (err != nil) != test.err {
+				t.Errorf("got error %v, want error %t", err, test.err)
+			}
+			if got := attempts.Load(); got != test.attempts {
+				t.Errorf("attempts: got %d, want %d", got, test.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	_, err := client.Get("page")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got error %v, want status code 503", err)
+	}
+	if got := attempts.Load(); got != 4 {
+		t.Errorf("attempts: got %d, want 4", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Run("honored", func(t *testing.T) {
+		var attempts atomic.Int32
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			json.NewEncoder(w).Encode(Page{ID: "page"})
+		})
+		start := time.Now()
+		if _, err := client.Get("page"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("retried after %s, want at least 1s", elapsed)
+		}
+	})
+	t.Run("longer than maximum delay", func(t *testing.T) {
+		var attempts atomic.Int32
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		if _, err := client.Get("page"); err == nil {
+			t.Error("expected an error")
+		}
+		if got := attempts.Load(); got != 1 {
+			t.Errorf("attempts: got %d, want 1", got)
+		}
+	})
+}
+
+func TestRetryAfterValue(t *testing.T) {
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, test := range tests {
+		delay, ok := retryAfter(test.value)
+		if delay != test.delay || ok != test.ok {
+			t.Errorf("retryAfter(%q): got %s %t, want %s %t", test.value, delay, ok, test.delay, test.ok)
+		}
+	}
+}
+
+func TestUpdateAppliedBeforeRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // server content once first attempt is applied
+		err     error
+	}{
+		{"same content", "new", nil},
+		{"other content", "edited by someone else", ErrConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet:
+					json.NewEncoder(w).Encode(Page{ID: "page", Version: 2, Content: test.content, DateModif: time.Now()})
+				case attempts.Add(1) == 1:
+					// applied, but response is lost
+					w.WriteHeader(http.StatusBadGateway)
+				default:
+					w.WriteHeader(http.StatusConflict)
+				}
+			})
+			page := &Page{ID: "page", Version: 2, Content: "new", DateModif: time.Now().Add(-time.Hour)}
+			updated, err := client.Update(page, false)
+			if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err == nil && updated.Content != "new" {
+				t.Errorf("content: got %q, want %q", updated.Content, "new")
+			}
+		})
+	}
+}
+
+func TestUpdateConflictWithoutRetry(t *testing.T) {
+	var gets atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		w.WriteHeader(http.StatusConflict)
+	})
+	_, err := client.Update(&Page{ID: "page", Version: 2, Content: "new"}, false)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("got error %v, want ErrConflict", err)
+	}
+	if gets.Load() != 0 {
+		t.Error("server version was checked while update was not retried")
+	}
+}
+
+func TestDeleteAppliedBeforeRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int // status of first attempt
+		err    error
+	}{
+		{"retried", http.StatusServiceUnavailable, nil},
+		{"not retried", http.StatusNotFound, ErrNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.WriteHeader(test.status)
+					return
+				}
+				w.WriteHeader(http.StatusNotFound)
+			})
+			err := client.Delete("page")
+			if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestAuthNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	if _, err := client.Auth("user", "password"); err == nil {
+		t.Error("expected an error")
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("attempts: got %d, want 1", got)
+	}
+}
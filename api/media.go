@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A file of W media library
+type Media struct {
+	Path      string    `json:"path"` // relative to media folder, with slash separators
+	Size      int64     `json:"size"`
+	DateModif time.Time `json:"datemodif"`
+}
+
+// escape each segment of a media path, to be used in URLs
+func escapeMediaPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
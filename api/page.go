@@ -1,16 +1,180 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
+const MaxIDLength = 64
+
+var ErrInvalidID = errors.New("invalid page ID")
+
+var idRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// A W page.
+// Empty metadata fields are omitted when sending a page, so that they are left untouched on the server.
+// Fields unknown to this package are kept in Extra, so that a page can be sent back without losing data.
 type Page struct {
 	ID        string    `json:"id"`
 	Version   int       `json:"version"`
 	Content   string    `json:"content"`
 	Main      string    `json:"main"`
 	DateModif time.Time `json:"datemodif"`
+
+	// metadata
+	Title        string    `json:"title,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	Lang         string    `json:"lang,omitempty"`
+	Tag          []string  `json:"tag,omitempty"`
+	Date         time.Time `json:"date,omitzero"`
+	DateCreation time.Time `json:"datecreation,omitzero"`
+	Secure       *int      `json:"secure,omitempty"` // 0: public, 1: private, 2: not published
+	Authors      []string  `json:"authors,omitempty"`
+	Redirection  string    `json:"redirection,omitempty"`
+	Refresh      int       `json:"refresh,omitempty"`
+	Password     string    `json:"password,omitempty"`
+	Sleep        int       `json:"sleep,omitempty"`
+	Favicon      string    `json:"favicon,omitempty"`
+	Thumbnail    string    `json:"thumbnail,omitempty"`
+
+	// version 1 elements
+	Header string `json:"header,omitempty"`
+	Nav    string `json:"nav,omitempty"`
+	Aside  string `json:"aside,omitempty"`
+	Footer string `json:"footer,omitempty"`
+
+	// layout and templates
+	CSS                string   `json:"css,omitempty"`
+	Javascript         string   `json:"javascript,omitempty"`
+	Body               string   `json:"body,omitempty"`
+	ExternalCSS        []string `json:"externalcss,omitempty"`
+	CustomHead         string   `json:"customhead,omitempty"`
+	Interface          string   `json:"interface,omitempty"`
+	TemplateBody       string   `json:"templatebody,omitempty"`
+	TemplateCSS        string   `json:"templatecss,omitempty"`
+	TemplateJavascript string   `json:"templatejavascript,omitempty"`
+	TemplateOptions    []string `json:"templateoptions,omitempty"`
+
+	// statistics, managed by the server
+	DisplayCount int `json:"displaycount,omitempty"`
+	VisitCount   int `json:"visitcount,omitempty"`
+	EditCount    int `json:"editcount,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// page without custom JSON methods, to use default encoding
+type rawPage Page
+
+// JSON keys of Page fields
+var pageKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Page{})
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}()
+
+func (p *Page) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*rawPage)(p)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	p.Extra = nil
+	for key, value := range fields {
+		if !pageKeys[key] {
+			if p.Extra == nil {
+				p.Extra = make(map[string]json.RawMessage)
+			}
+			p.Extra[key] = value
+		}
+	}
+	return nil
+}
+
+func (p Page) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(rawPage(p))
+	if err != nil || len(p.Extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range p.Extra {
+		if _, exist := fields[key]; !exist {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// fields updated by the server on each modification or visit
+var serverManagedKeys = []string{"datemodif", "displaycount", "visitcount", "editcount"}
+
+// Check if server page has the values of the fields of sent page, ignoring the ones managed by the server.
+// Fields sent empty may be omitted by the server.
+func sameFields(sent *Page, server *Page) bool {
+	sentFields, err := fieldValues(sent)
+	if err != nil {
+		return false
+	}
+	serverFields, err := fieldValues(server)
+	if err != nil {
+		return false
+	}
+	for key, value := range sentFields {
+		if slices.Contains(serverManagedKeys, key) {
+			continue
+		}
+		if !reflect.DeepEqual(value, serverFields[key]) && !(emptyValue(value) && emptyValue(serverFields[key])) {
+			return false
+		}
+	}
+	return true
+}
+
+// page fields as they are sent in JSON
+func fieldValues(page *Page) (map[string]any, error) {
+	data, err := json.Marshal(page)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+func emptyValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []any:
+		return len(v) == 0
+	default:
+		return false
+	}
 }
 
 func (p *Page) Primary() string {
@@ -34,3 +198,17 @@ func (p *Page) SetPrimary(primary string) {
 		panic(fmt.Sprintf("Unsuported version: %d", p.Version))
 	}
 }
+
+// check that ID follows W rules: only lowercase letters, digits, hyphens and underscores
+func ValidateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: empty ID", ErrInvalidID)
+	}
+	if len(id) > MaxIDLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidID, id, MaxIDLength)
+	}
+	if !idRegexp.MatchString(id) {
+		return fmt.Errorf("%w: %q should only contain lowercase letters, digits, hyphens and underscores", ErrInvalidID, id)
+	}
+	return nil
+}
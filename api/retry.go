@@ -0,0 +1,74 @@
+package api
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy to retry requests failing because of a transient error:
+// no response from the server, or status code 429, 502, 503 or 504.
+// Only requests that are safe to send again are retried.
+type RetryPolicy struct {
+	MaxRetries int           // number of retries after the first attempt, zero disables retries
+	BaseDelay  time.Duration // delay before first retry, doubled on each following retry
+	MaxDelay   time.Duration // maximum delay between two attempts, requests are not retried if server asks to wait longer
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   10 * time.Second,
+}
+
+// check if status code is worth retrying
+func transientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Delay before given retry, starting from 1.
+// Retry-After header of response is honored if present,
+// otherwise delay grows exponentially, with jitter so that concurrent requests do not retry at the same time.
+// Return false if server asks to wait longer than maximum delay, as request should not be retried then.
+func (p RetryPolicy) delay(retry int, res *http.Response) (time.Duration, bool) {
+	if res != nil {
+		if after, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			return after, p.MaxDelay <= 0 || after <= p.MaxDelay
+		}
+	}
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0, true
+	}
+	return delay/2 + rand.N(delay/2+1), true
+}
+
+// parse Retry-After header value, either a number of seconds or a date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// read and close response body, so that connection can be reused
+func discard(res *http.Response) {
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
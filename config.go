@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+type configEntry struct {
+	description string
+	get         func(db *Database) string
+	set         func(db *Database, value string) error
+}
+
+var configEntries = map[string]configEntry{
+	"frontmatter": {
+		description: "store page metadata as YAML front matter in local files (true or false)",
+		get:         func(db *Database) string { return strconv.FormatBool(db.Config.FrontMatter) },
+		set: func(db *Database, value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("expected true or false")
+			}
+			db.Config.FrontMatter = enabled
+			return nil
+		},
+	},
+	"v1directory": {
+		description: "store new version 1 pages as directories, with one file per element (true or false)",
+		get:         func(db *Database) string { return strconv.FormatBool(db.Config.V1Directory) },
+		set: func(db *Database, value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("expected true or false")
+			}
+			db.Config.V1Directory = enabled
+			return nil
+		},
+	},
+	"mediadir": {
+		description: "folder where media files are stored, relative to repository",
+		get:         func(db *Database) string { return db.mediaDir() },
+		set: func(db *Database, value string) error {
+			dir := filepath.Clean(value)
+			if !filepath.IsLocal(dir) || dir == "." || strings.HasPrefix(filepath.ToSlash(dir), ".wsync") {
+				return fmt.Errorf("expected a sub-folder of the repository")
+			}
+			db.Config.MediaDir = filepath.ToSlash(dir)
+			return nil
+		},
+	},
+	"timeout": {
+		description: "maximum duration of each request to the server, or of inactivity during media transfers, like 30s or 2m",
+		get: func(db *Database) string {
+			if db.Config.Timeout == 0 {
+				return api.DefaultTimeout.String()
+			}
+			return db.Config.Timeout.String()
+		},
+		set: func(db *Database, value string) error {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("expected a positive duration, like 30s or 2m")
+			}
+			db.Config.Timeout = timeout
+			return nil
+		},
+	},
+	"retries": {
+		description: "number of retries of requests failing because of a network error or an overloaded server, 0 to disable",
+		get: func(db *Database) string {
+			if db.Config.Retries == nil {
+				return strconv.Itoa(api.DefaultRetryPolicy.MaxRetries)
+			}
+			return strconv.Itoa(*db.Config.Retries)
+		},
+		set: func(db *Database, value string) error {
+			retries, err := strconv.Atoi(value)
+			if err != nil || retries < 0 {
+				return fmt.Errorf("expected a positive number or 0")
+			}
+			db.Config.Retries = &retries
+			return nil
+		},
+	},
+	"retrydelay": {
+		description: "delay before first retry, doubled on each following one, like 500ms or 2s",
+		get: func(db *Database) string {
+			if db.Config.RetryDelay == 0 {
+				return api.DefaultRetryPolicy.BaseDelay.String()
+			}
+			return db.Config.RetryDelay.String()
+		},
+		set: func(db *Database, value string) error {
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay <= 0 {
+				return fmt.Errorf("expected a positive duration, like 500ms or 2s")
+			}
+			db.Config.RetryDelay = delay
+			return nil
+		},
+	},
+	"credentials": {
+		description: "where the authentication token is stored: file, keyring, encrypted or env",
+		get: func(db *Database) string {
+			if db.Config.Credentials == "" {
+				return CredentialsFile
+			}
+			return db.Config.Credentials
+		},
+		set: func(db *Database, value string) error {
+			if !slices.Contains(credentialStores, value) {
+				return fmt.Errorf("expected one of %s", strings.Join(credentialStores, ", "))
+			}
+			return db.switchTokenStore(value)
+		},
+	},
+	"sidecars": {
+		description: "store CSS and JavaScript of new pages in PAGE_ID.css and PAGE_ID.js files (true or false)",
+		get:         func(db *Database) string { return strconv.FormatBool(db.Config.Sidecars) },
+		set: func(db *Database, value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("expected true or false")
+			}
+			db.Config.Sidecars = enabled
+			return nil
+		},
+	},
+}
+
+func Config(args []string) {
+	database := LoadDatabase()
+
+	switch len(args) {
+	case 0:
+		for _, key := range slices.Sorted(maps.Keys(configEntries)) {
+			entry := configEntries[key]
+			fmt.Printf("%s = %s\t# %s\n", key, entry.get(database), entry.description)
+		}
+	case 1:
+		entry, exist := configEntries[args[0]]
+		if !exist {
+			log.Fatalf("unknown config key %q", args[0])
+		}
+		fmt.Println(entry.get(database))
+	case 2:
+		entry, exist := configEntries[args[0]]
+		if !exist {
+			log.Fatalf("unknown config key %q", args[0])
+		}
+		if err := entry.set(database, args[1]); err != nil {
+			log.Fatalf("invalid value for %q: %v", args[0], err)
+		}
+		SaveDatabase(database)
+		fmt.Printf("⚙️  %s set to %s\n", args[0], entry.get(database))
+	default:
+		log.Fatalln("config sub-command take at most two arguments: KEY VALUE")
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/huh"
+)
+
+// The authentication token can be stored in a plain file (the default), in the OS keyring,
+// in a file encrypted with a passphrase, or be read from an environment variable.
+// The store is chosen per repository with the credentials config key.
+
+const (
+	CredentialsFile      = "file"
+	CredentialsKeyring   = "keyring"
+	CredentialsEncrypted = "encrypted"
+	CredentialsEnv       = "env"
+)
+
+var credentialStores = []string{CredentialsFile, CredentialsKeyring, CredentialsEncrypted, CredentialsEnv}
+
+const (
+	TokenEnv      = "WSYNC_TOKEN"      // token used by env store
+	PassphraseEnv = "WSYNC_PASSPHRASE" // passphrase used by encrypted store, asked if not set
+)
+
+// returned when trying to write a token in a store that can only be read
+var errReadOnlyStore = fmt.Errorf("token is read from %s environment variable, it cannot be changed by wsync", TokenEnv)
+
+// where the authentication token is stored
+type tokenStore interface {
+	load() (string, error) // empty if there is no token
+	save(token string) error
+	delete() (bool, error) // false if there was no token
+}
+
+// store selected in repository config
+func (db *Database) tokenStore() tokenStore {
+	return newTokenStore(db.Config.Credentials)
+}
+
+func newTokenStore(kind string) tokenStore {
+	switch kind {
+	case CredentialsKeyring:
+		account, err := filepath.Abs(repoPath)
+		if err != nil {
+			account = repoPath
+		}
+		return keyringStore{account}
+	case CredentialsEncrypted:
+		return encryptedStore{filepath.Join(repoPath, EncryptedTokenPath)}
+	case CredentialsEnv:
+		return envStore{}
+	default:
+		return fileStore{filepath.Join(repoPath, TokenPath)}
+	}
+}
+
+// check if token is read from a store that wsync can not change
+func (db *Database) tokenReadOnly() bool {
+	_, isEnv := db.tokenStore().(envStore)
+	return isEnv
+}
+
+// Move token from current store to the given one.
+// If keyring is not available, file store is used instead.
+// Token can not be moved to environment: a clear text token is then deleted, so that it does not leak,
+// while one stored in keyring or encrypted file is kept.
+func (db *Database) switchTokenStore(kind string) error {
+	if kind == CredentialsKeyring {
+		if err := keyringAvailable(); err != nil {
+			fmt.Printf("⚠️  %v, falling back to %s credentials\n", err, CredentialsFile)
+			kind = CredentialsFile
+		}
+	}
+	if kind == db.Config.Credentials || (kind == CredentialsFile && db.Config.Credentials == "") {
+		return nil
+	}
+	current := db.tokenStore()
+	if kind == CredentialsEnv {
+		if _, clearText := current.(fileStore); clearText {
+			if _, err := current.delete(); err != nil {
+				return fmt.Errorf("delete token from current store: %w", err)
+			}
+		}
+		db.Config.Credentials = kind
+		return nil
+	}
+	token, err := current.load()
+	if err != nil {
+		return fmt.Errorf("load token from current store: %w", err)
+	}
+	if token != "" {
+		if err := newTokenStore(kind).save(token); err != nil {
+			return fmt.Errorf("save token in new store: %w", err)
+		}
+		if _, err := current.delete(); err != nil && !errors.Is(err, errReadOnlyStore) {
+			return fmt.Errorf("delete token from current store: %w", err)
+		}
+	}
+	db.Config.Credentials = kind
+	return nil
+}
+
+// token stored in clear text
+type fileStore struct {
+	filename string
+}
+
+func (s fileStore) load() (string, error) {
+	token, err := os.ReadFile(s.filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(token), err
+}
+
+func (s fileStore) save(token string) error {
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(s.filename, []byte(token), 0640)
+}
+
+func (s fileStore) delete() (bool, error) {
+	return removeIfExist(s.filename)
+}
+
+// token read from WSYNC_TOKEN environment variable
+type envStore struct{}
+
+func (envStore) load() (string, error) {
+	return os.Getenv(TokenEnv), nil
+}
+
+func (envStore) save(token string) error {
+	return errReadOnlyStore
+}
+
+func (envStore) delete() (bool, error) {
+	return false, errReadOnlyStore
+}
+
+// Token stored in the OS keyring, using Secret Service on Linux and Keychain on macOS.
+// It is identified by the absolute path of the repository.
+type keyringStore struct {
+	account string
+}
+
+const keyringService = "wsync"
+
+func (s keyringStore) load() (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", s.account, "-w")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "repository", s.account)
+	}
+	output, err := runKeyring(cmd, nil)
+	if errors.Is(err, errKeyringNotFound) {
+		return "", nil
+	}
+	return strings.TrimSuffix(string(output), "\n"), err
+}
+
+func (s keyringStore) save(token string) error {
+	var cmd *exec.Cmd
+	var stdin []byte
+	switch runtime.GOOS {
+	case "darwin":
+		// command is written on stdin of interactive mode, so that token does not appear in process arguments
+		cmd = exec.Command("security", "-i")
+		stdin = []byte(fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -w %s\n",
+			securityQuote(keyringService), securityQuote(s.account), securityQuote("wsync token for "+s.account), securityQuote(token)))
+	default:
+		cmd = exec.Command("secret-tool", "store", "--label", "wsync token for "+s.account, "service", keyringService, "repository", s.account)
+		stdin = []byte(token)
+	}
+	_, err := runKeyring(cmd, stdin)
+	return err
+}
+
+func (s keyringStore) delete() (bool, error) {
+	token, err := s.load()
+	if err != nil || token == "" {
+		return false, err
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", s.account)
+	default:
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "repository", s.account)
+	}
+	_, err = runKeyring(cmd, nil)
+	return err == nil, err
+}
+
+var errKeyringNotFound = errors.New("token not found in keyring")
+
+// check that the command used to access the keyring can be run
+func keyringAvailable() error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("keyring is not supported on Windows")
+	}
+	command := "secret-tool"
+	if runtime.GOOS == "darwin" {
+		command = "security"
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return fmt.Errorf("keyring is not available, %s command was not found", command)
+	}
+	return nil
+}
+
+// run keyring command, return its output
+func runKeyring(cmd *exec.Cmd, stdin []byte) ([]byte, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("keyring is not supported on Windows, use encrypted credentials instead")
+	}
+	if cmd.Err != nil {
+		return nil, fmt.Errorf("keyring: %w", cmd.Err)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	message := strings.TrimSpace(stderr.String())
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		if err == nil && message != "" && slices.Contains(cmd.Args, "-i") {
+			// security does not report failures of interactive commands in its exit code
+			return nil, fmt.Errorf("keyring: %s", message)
+		}
+		return output, err
+	}
+	// secret-tool exits silently with code 1, security exits with code 44
+	if (runtime.GOOS == "darwin" && exitErr.ExitCode() == 44) || (runtime.GOOS != "darwin" && exitErr.ExitCode() == 1 && message == "") {
+		return nil, errKeyringNotFound
+	}
+	return nil, fmt.Errorf("keyring: %w: %s", err, message)
+}
+
+// quote an argument of a command run in security interactive mode
+func securityQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// Token stored in a file encrypted with AES-GCM, using a key derived from a passphrase with PBKDF2.
+// File contains a header line followed by salt, nonce and ciphertext encoded in base64.
+type encryptedStore struct {
+	filename string
+}
+
+const (
+	encryptedTokenHeader = "wsync encrypted token v1\n"
+	pbkdf2Iterations     = 600_000
+	saltSize             = 16
+)
+
+// passphrase entered by user, kept to avoid asking it twice
+var passphrase string
+
+func (s encryptedStore) load() (string, error) {
+	content, err := os.ReadFile(s.filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	encoded, found := strings.CutPrefix(string(content), encryptedTokenHeader)
+	if !found {
+		return "", fmt.Errorf("unknown format of encrypted token file")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted token: %w", err)
+	}
+	if len(data) < saltSize {
+		return "", fmt.Errorf("encrypted token is too short")
+	}
+
+	secret, err := askPassphrase(false)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := tokenCipher(secret, data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted token is too short")
+	}
+	token, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt token, wrong passphrase ?")
+	}
+	return string(token), nil
+}
+
+func (s encryptedStore) save(token string) error {
+	secret, err := askPassphrase(true)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, saltSize)
+	rand.Read(salt)
+	gcm, err := tokenCipher(secret, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+
+	data := append(salt, gcm.Seal(nonce, nonce, []byte(token), nil)...)
+	content := encryptedTokenHeader + base64.StdEncoding.EncodeToString(data) + "\n"
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(s.filename, []byte(content), 0600)
+}
+
+func (s encryptedStore) delete() (bool, error) {
+	return removeIfExist(s.filename)
+}
+
+// AES-GCM cipher using a key derived from passphrase
+func tokenCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Passphrase from WSYNC_PASSPHRASE environment variable, or asked to user.
+// When setting a new passphrase, user has to type it twice.
+func askPassphrase(confirm bool) (string, error) {
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		return env, nil
+	}
+	if passphrase != "" {
+		return passphrase, nil
+	}
+
+	var entered, confirmed string
+	fields := []huh.Field{
+		huh.NewInput().
+			EchoMode(huh.EchoMode(textinput.EchoPassword)).
+			Title("Passphrase of the authentication token").
+			Value(&entered),
+	}
+	if confirm {
+		fields = append(fields, huh.NewInput().
+			EchoMode(huh.EchoMode(textinput.EchoPassword)).
+			Title("Confirm passphrase").
+			Value(&confirmed))
+	}
+	if err := huh.NewForm(huh.NewGroup(fields...)).Run(); err != nil {
+		return "", err
+	}
+	if entered == "" {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	if confirm && entered != confirmed {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	passphrase = entered
+	return passphrase, nil
+}
+
+// delete a file, return false if it did not exist
+func removeIfExist(filename string) (bool, error) {
+	err := os.Remove(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
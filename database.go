@@ -1,29 +1,57 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/vincent-peugnet/wsync/api"
 )
 
 type PageData struct {
-	Version   int
-	DateModif time.Time
-	DateSync  time.Time
+	Version    int
+	DateModif  time.Time // server modification date at last sync, compared with server dates to detect remote changes
+	DateSync   time.Time // taken before reading local file, so that edits made during requests are detected
+	Hash       string    // hash of last synced content
+	Conflicted bool      // local file contains conflict markers waiting to be resolved
+
+	RemoteDateModif time.Time // server modification date as seen during last fetch
+	RemoteDeleted   bool      // page was missing on server during last fetch
+
+	Directory bool // version 1 page stored as a directory, with one file per element
+	Sidecars  bool // CSS and JavaScript stored in PAGE_ID.css and PAGE_ID.js files
 }
 
+var ErrUnresolved = errors.New("unresolved conflict")
+
+// returned when a page was renamed but its old version could not be deleted on the server
+var ErrOldPageKept = errors.New("old page was kept on server")
+
 type Database struct {
-	Pages  map[string]*PageData
-	Config struct {
-		BaseURL string
+	Pages     map[string]*PageData
+	Media     map[string]*MediaData // tracked media files, by path relative to media folder
+	DateFetch time.Time             // last time remote state was fetched
+	Config    struct {
+		BaseURL     string
+		FrontMatter bool          // store page metadata as YAML front matter in local files
+		V1Directory bool          // store new version 1 pages as directories, with one file per element
+		Sidecars    bool          // store CSS and JavaScript of new pages in sidecar files
+		MediaDir    string        // folder where media files are stored, relative to repository
+		Timeout     time.Duration // maximum duration of API requests, api.DefaultTimeout if zero
+		Retries     *int          // retries of API requests failing because of a transient error, api.DefaultRetryPolicy if nil
+		RetryDelay  time.Duration // delay before first retry, api.DefaultRetryPolicy if zero
+		Credentials string        // where authentication token is stored, plain file if empty
 	}
+	mu sync.Mutex // guard Pages and Media, as they can be processed concurrently
 }
 
 func NewDatabase() *Database {
@@ -32,25 +60,125 @@ func NewDatabase() *Database {
 	}
 }
 
+// return a copy of the data of a tracked page
+func (db *Database) page(id string) (*PageData, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	pageData, exist := db.Pages[id]
+	if !exist {
+		return nil, false
+	}
+	pageDataCopy := *pageData
+	return &pageDataCopy, true
+}
+
+// track page or update its data
+func (db *Database) setPage(id string, pageData *PageData) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Pages[id] = pageData
+}
+
+func (db *Database) untrack(id string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.Pages, id)
+}
+
+// return IDs of all tracked pages
+func (db *Database) ids() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return slices.Collect(maps.Keys(db.Pages))
+}
+
 // checks if given page has beed modified locally
 func (db *Database) HasBeenModified(id string) (bool, error) {
-	pageData, exist := db.Pages[id]
+	pageData, exist := db.page(id)
 	if !exist {
 		return false, fmt.Errorf("not found in tracked pages")
 	}
-	filename := GetPagePath(id)
-
-	stat, err := os.Stat(filename)
+	modTime, err := localModTime(id, pageData.layout())
 	if err != nil {
 		return false, fmt.Errorf("file not found: %w", err)
 	}
-	return stat.ModTime().After(pageData.DateSync), nil
+	if !modTime.After(pageData.DateSync) {
+		return false, nil // file was not touched since last sync
+	}
+	if pageData.Hash == "" {
+		return true, nil // page synced before content hashing was introduced
+	}
+
+	content, err := readLocal(id, pageData.layout())
+	if err != nil {
+		return false, fmt.Errorf("read file: %w", err)
+	}
+	return hashContent(content) != pageData.Hash, nil
+}
+
+// checks if given page has been modified on the server since last sync, according to last fetch
+func (db *Database) HasBeenModifiedRemotely(id string) (bool, error) {
+	pageData, exist := db.page(id)
+	if !exist {
+		return false, fmt.Errorf("not found in tracked pages")
+	}
+	return pageData.RemoteDateModif.After(pageData.DateModif), nil
+}
+
+type PageState string
+
+const (
+	StateUpToDate  PageState = "up-to-date"
+	StateModified  PageState = "modified"
+	StateBehind    PageState = "remotely-modified"
+	StateDiverged  PageState = "diverged"
+	StateConflict  PageState = "conflicted"
+	StateUntracked PageState = "untracked"
+
+	StateDeletedLocally  PageState = "deleted-locally"
+	StateDeletedRemotely PageState = "deleted-on-server"
+)
+
+// classify a tracked page by comparing local file, last sync and last fetch
+func (db *Database) State(id string) (PageState, error) {
+	pageData, exist := db.page(id)
+	if !exist {
+		return StateUntracked, nil
+	}
+	if pageData.RemoteDeleted {
+		return StateDeletedRemotely, nil
+	}
+	if _, err := os.Stat(localPath(id, pageData.layout())); errors.Is(err, fs.ErrNotExist) {
+		return StateDeletedLocally, nil
+	}
+	if pageData.Conflicted {
+		return StateConflict, nil
+	}
+
+	modified, err := db.HasBeenModified(id)
+	if err != nil {
+		return "", err
+	}
+	remotelyModified, err := db.HasBeenModifiedRemotely(id)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case modified && remotelyModified:
+		return StateDiverged, nil
+	case modified:
+		return StateModified, nil
+	case remotelyModified:
+		return StateBehind, nil
+	default:
+		return StateUpToDate, nil
+	}
 }
 
 // return list of localy edited pages
-func (db Database) EditedPages() []string {
+func (db *Database) EditedPages() []string {
 	var editedPages []string
-	for id := range db.Pages {
+	for _, id := range db.ids() {
 		modified, err := db.HasBeenModified(id)
 		if err == nil && modified {
 			editedPages = append(editedPages, id)
@@ -96,18 +224,83 @@ func SaveDatabase(database *Database) {
 	}
 }
 
+// store the last synced content of a page
+func saveBase(id string, content string) error {
+	filename := GetBasePath(id)
+	if err := os.MkdirAll(filepath.Dir(filename), 0775); err != nil {
+		return fmt.Errorf("save base: %w", err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0664); err != nil {
+		return fmt.Errorf("save base: %w", err)
+	}
+	return nil
+}
+
+// load the last synced content of a page
+func loadBase(id string) (string, error) {
+	content, err := os.ReadFile(GetBasePath(id))
+	if err != nil {
+		return "", fmt.Errorf("load base: %w", err)
+	}
+	return string(content), nil
+}
+
+// store the server version of a page, as fetched
+func saveRemote(id string, content string) error {
+	filename := GetRemotePath(id)
+	if err := os.MkdirAll(filepath.Dir(filename), 0775); err != nil {
+		return fmt.Errorf("save remote: %w", err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0664); err != nil {
+		return fmt.Errorf("save remote: %w", err)
+	}
+	return nil
+}
+
+func removeRemote(id string) error {
+	err := os.Remove(GetRemotePath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove remote: %w", err)
+	}
+	return nil
+}
+
+func removeBase(id string) error {
+	err := os.Remove(GetBasePath(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove base: %w", err)
+	}
+	return nil
+}
+
+// untrack page and remove stored versions, but keep local file
+func (db *Database) forgetPage(id string) error {
+	db.untrack(id)
+	if err := removeBase(id); err != nil {
+		return err
+	}
+	return removeRemote(id)
+}
+
 // Remove local page
 // return true if local file was deleted
 func (db *Database) removePage(id string) (bool, error) {
+	l := db.layout(id)
 	modified, err := db.HasBeenModified(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		// local file was already deleted, there is nothing left to delete
+		return false, db.forgetPage(id)
+	}
 	if err != nil {
 		return false, fmt.Errorf("tried to untrack: %w", err)
 	}
-	delete(db.Pages, id) // untrack
-	if modified {        // Do not delete the page if localy edited
+	if err := db.forgetPage(id); err != nil {
+		return false, err
+	}
+	if modified { // Do not delete the page if localy edited
 		return false, nil
 	} else {
-		err := os.Remove(GetPagePath(id))
+		err := removeLocal(id, l)
 		if err != nil {
 			return false, fmt.Errorf("tried to delete file: %w", err)
 		}
@@ -115,54 +308,272 @@ func (db *Database) removePage(id string) (bool, error) {
 	}
 }
 
-func (db *Database) addPage(co *api.Client, id string) error {
-	_, exist := db.Pages[id]
+// flag tracked page as deleted on the server
+func (db *Database) markDeletedRemotely(id string) {
+	pageData, exist := db.page(id)
 	if exist {
-		return fmt.Errorf("page is already tracked")
+		pageData.RemoteDeleted = true
+		db.setPage(id, pageData)
+	}
+}
+
+// Rename page on the server by creating a copy and deleting the original,
+// then rename local file and migrate tracking data.
+// If old local file is missing but new one exist, it is considered already renamed locally.
+// Once the copy is created, the new page is tracked even if the original can not be deleted:
+// an error of type ErrOldPageKept is then returned.
+func (db *Database) movePage(ctx context.Context, co *api.Client, oldID string, newID string, force bool) error {
+	if err := api.ValidateID(newID); err != nil {
+		return err
+	}
+	pageData, exist := db.page(oldID)
+	if !exist {
+		return fmt.Errorf("untracked page")
+	}
+	if _, exist := db.page(newID); exist {
+		return fmt.Errorf("page %q is already tracked", newID)
 	}
 
-	filename := GetPagePath(id)
+	oldFilename := localPath(oldID, pageData.layout())
+	newFilename := localPath(newID, pageData.layout())
+	_, oldErr := os.Stat(oldFilename)
+	_, newErr := os.Stat(newFilename)
+	renamedLocally := errors.Is(oldErr, fs.ErrNotExist) && newErr == nil
+	if !renamedLocally && newErr == nil {
+		return fmt.Errorf("local file %q already exist", newFilename)
+	}
 
-	if _, err := os.Stat(filename); err == nil {
-		return fmt.Errorf("local file already exist")
+	syncedAt := time.Now()
+	var modified bool
+	if !renamedLocally {
+		var err error
+		modified, err = db.HasBeenModified(oldID)
+		if err != nil {
+			return err
+		}
+	}
+
+	page, err := co.GetContext(ctx, oldID)
+	if err != nil {
+		return fmt.Errorf("get page: %w", err)
+	}
+	if !force && page.DateModif.After(pageData.DateModif) {
+		return fmt.Errorf("%w: page was modified on server since last sync", api.ErrConflict)
+	}
+
+	content := db.localContent(page)
+	page.ID = newID
+	// creation date and statistics belong to the old page, server sets them for the new one
+	page.DateCreation = time.Time{}
+	page.DisplayCount, page.VisitCount, page.EditCount = 0, 0, 0
+	addedPage, err := co.AddContext(ctx, page)
+	if err != nil {
+		return fmt.Errorf("add page %q: %w", newID, err)
+	}
+
+	if !renamedLocally {
+		if err := renameLocal(oldID, newID, pageData.layout()); err != nil {
+			return fmt.Errorf("rename file: %w", err)
+		}
+	}
+	if err := db.forgetPage(oldID); err != nil {
+		return err
+	}
+	if err := saveBase(newID, content); err != nil {
+		return err
+	}
+
+	pageData.Version = page.Version
+	pageData.DateModif = addedPage.DateModif
+	pageData.Hash = hashContent(content)
+	pageData.RemoteDateModif = time.Time{}
+	pageData.RemoteDeleted = false
+	// otherwise, keep previous sync date so that local edits are still detected
+	if !modified && !renamedLocally {
+		pageData.DateSync = syncedAt
+	}
+	db.setPage(newID, pageData)
+
+	if err := co.DeleteContext(ctx, oldID); err != nil {
+		return fmt.Errorf("%w: %q could not be deleted: %w", ErrOldPageKept, oldID, err)
+	}
+	return nil
+}
+
+// Delete page on the server.
+// Refuse if the page was modified on the server since last sync, unless force is true.
+// Local file is not touched, use removePage to untrack it.
+// Return false if the page was already deleted on the server.
+func (db *Database) deleteRemotePage(ctx context.Context, co *api.Client, id string, force bool) (bool, error) {
+	pageData, exist := db.page(id)
+	if !exist {
+		return false, fmt.Errorf("untracked page")
+	}
+
+	if !force {
+		page, err := co.GetContext(ctx, id)
+		if errors.Is(err, api.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("get page: %w", err)
+		}
+		if page.DateModif.After(pageData.DateModif) {
+			return false, fmt.Errorf("%w: page was modified on server since last sync", api.ErrConflict)
+		}
 	}
 
-	page, err := co.Get(id)
+	err := co.DeleteContext(ctx, id)
+	if errors.Is(err, api.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("delete page: %w", err)
+	}
+	return true, nil
+}
+
+func (db *Database) addPage(ctx context.Context, co *api.Client, id string) error {
+	_, exist := db.page(id)
+	if exist {
+		return fmt.Errorf("page is already tracked")
+	}
+
+	page, err := co.GetContext(ctx, id)
 	if err != nil {
 		return fmt.Errorf("tried to get page: %w", err)
 	}
 
-	if err := os.WriteFile(filename, []byte(page.Primary()), 0664); err != nil {
+	if _, err := os.Stat(localPath(id, db.pageLayout(page))); err == nil {
+		return fmt.Errorf("local file already exist")
+	}
+
+	return db.writePage(page)
+}
+
+// write server version of page locally and record it as synced
+func (db *Database) writePage(page *api.Page) error {
+	l := db.pageLayout(page)
+	content := db.localContent(page)
+	if err := writeLocal(page.ID, l, content); err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
+	if err := saveBase(page.ID, content); err != nil {
+		return err
+	}
+	if err := removeRemote(page.ID); err != nil {
+		return err
+	}
 
 	pageData := &PageData{
 		Version:   page.Version,
 		DateModif: page.DateModif,
 		DateSync:  time.Now(),
+		Hash:      hashContent(content),
+		Directory: l.directory,
+		Sidecars:  l.sidecars,
 	}
-	db.Pages[id] = pageData
+	db.setPage(page.ID, pageData)
 
 	return nil
 }
 
-func (db *Database) pullPage(co *api.Client, id string, force bool) (bool, error) {
-	page, err := co.Get(id)
+// download again the page whose local file was deleted
+func (db *Database) restorePage(ctx context.Context, co *api.Client, id string) error {
+	if _, exist := db.page(id); !exist {
+		return fmt.Errorf("untracked page")
+	}
+
+	page, err := co.GetContext(ctx, id)
+	if errors.Is(err, api.ErrNotFound) {
+		db.markDeletedRemotely(id)
+	}
 	if err != nil {
-		return false, fmt.Errorf("get page: %w", err)
+		return fmt.Errorf("get page: %w", err)
 	}
 
-	filename := GetPagePath(id)
+	return db.writePage(page)
+}
 
-	pageData, exist := db.Pages[id]
+// Create page on the server and track it.
+// If fromFile is true, local file content is used, otherwise an empty page and its file are created.
+func (db *Database) createPage(ctx context.Context, co *api.Client, id string, fromFile bool) error {
+	if err := api.ValidateID(id); err != nil {
+		return err
+	}
+	if _, exist := db.page(id); exist {
+		return fmt.Errorf("page is already tracked")
+	}
+
+	page := &api.Page{
+		ID:      id,
+		Version: 2,
+	}
+	l := db.pageLayout(page)
+
+	syncedAt := time.Now()
+	var content string
+	if fromFile {
+		var err error
+		content, err = readLocal(id, l)
+		if err != nil {
+			return fmt.Errorf("read file: %w", err)
+		}
+	} else if _, err := os.Stat(localPath(id, l)); err == nil {
+		return fmt.Errorf("local file already exist")
+	} else if l.joined() {
+		content = joinParts(l.parts(id), nil)
+	}
+
+	if err := db.setLocalContent(page, content); err != nil {
+		return err
+	}
+	addedPage, err := co.AddContext(ctx, page)
+	if err != nil {
+		return fmt.Errorf("add page: %w", err)
+	}
+
+	if !fromFile {
+		if err := writeLocal(id, l, content); err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+	}
+	if err := saveBase(id, content); err != nil {
+		return err
+	}
+
+	pageData := &PageData{
+		Version:   page.Version,
+		DateModif: addedPage.DateModif,
+		DateSync:  syncedAt,
+		Hash:      hashContent(content),
+		Directory: l.directory,
+		Sidecars:  l.sidecars,
+	}
+	db.setPage(id, pageData)
+
+	return nil
+}
+
+func (db *Database) pullPage(ctx context.Context, co *api.Client, id string, force bool) (bool, error) {
+	page, err := co.GetContext(ctx, id)
+	if errors.Is(err, api.ErrNotFound) {
+		db.markDeletedRemotely(id)
+		return false, fmt.Errorf("get page: %w", err)
+	}
+	if err != nil {
+		return false, fmt.Errorf("get page: %w", err)
+	}
+
+	pageData, exist := db.page(id)
 	if !exist {
-		if _, err := os.Stat(filename); err == nil {
+		if _, err := os.Stat(localPath(id, db.pageLayout(page))); err == nil {
 			return false, fmt.Errorf("local file already exist")
 		}
 		return false, fmt.Errorf("untracked page")
 	}
 
-	if pageData.DateSync.After(page.DateModif) {
+	if !page.DateModif.After(pageData.DateModif) {
 		return false, nil // already up to date
 	}
 
@@ -174,32 +585,29 @@ func (db *Database) pullPage(co *api.Client, id string, force bool) (bool, error
 		return false, fmt.Errorf("local modification")
 	}
 
-	if err := os.WriteFile(filename, []byte(page.Primary()), 0664); err != nil {
-		return false, fmt.Errorf("write file: %w", err)
-	}
-
-	pageData = &PageData{
-		Version:   page.Version,
-		DateModif: page.DateModif,
-		DateSync:  time.Now(),
+	if err := db.writePage(page); err != nil {
+		return false, err
 	}
-	db.Pages[id] = pageData
 
 	return true, nil
 }
 
-func (db *Database) pushPage(co *api.Client, id string, force bool) (bool, error) {
-	pageData, exist := db.Pages[id]
+func (db *Database) pushPage(ctx context.Context, co *api.Client, id string, force bool) (bool, error) {
+	pageData, exist := db.page(id)
 	if !exist {
 		return false, fmt.Errorf("ID not in database: %s", id)
 	}
 
-	filename := GetPagePath(id)
-	content, err := os.ReadFile(filename)
+	syncedAt := time.Now()
+	content, err := readLocal(id, pageData.layout())
 	if err != nil {
 		return false, fmt.Errorf("read file: %w", err)
 	}
 
+	if pageData.Conflicted || hasConflictMarkers(content) {
+		return false, fmt.Errorf("%w: fix the file then run 'wsync resolve %s'", ErrUnresolved, id)
+	}
+
 	modified, err := db.HasBeenModified(id)
 	if err != nil {
 		return false, err
@@ -210,28 +618,355 @@ func (db *Database) pushPage(co *api.Client, id string, force bool) (bool, error
 			Version:   pageData.Version,
 			DateModif: pageData.DateModif,
 		}
-		page.SetPrimary(string(content))
+		if err := db.setLocalContent(page, content); err != nil {
+			return false, err
+		}
 
-		updatedPage, err := co.Update(page, force)
+		updatedPage, err := co.UpdateContext(ctx, page, force)
+		if errors.Is(err, api.ErrNotFound) {
+			db.markDeletedRemotely(id)
+		}
 		if err != nil {
 			return false, fmt.Errorf("update page: %w", err)
 		}
 		pageData.DateModif = updatedPage.DateModif
-		pageData.DateSync = time.Now()
+		pageData.DateSync = syncedAt
+		pageData.Hash = hashContent(content)
+		db.setPage(id, pageData)
+		if err := saveBase(id, content); err != nil {
+			return true, err
+		}
 	}
 
 	return modified, nil
 }
 
-func (db *Database) syncPage(co *api.Client, id string) (bool, error) {
-	pushed, pushErr := db.pushPage(co, id, false)
+// Force push given content of a tracked page, even if it is identical to last synced one,
+// so that it replaces server version. Content is written locally once pushed.
+func (db *Database) forcePushPage(ctx context.Context, co *api.Client, id string, content string) error {
+	pageData, exist := db.page(id)
+	if !exist {
+		return fmt.Errorf("ID not in database: %s", id)
+	}
+	if hasConflictMarkers(content) {
+		return fmt.Errorf("%w: content still contains conflict markers", ErrUnresolved)
+	}
+
+	page := &api.Page{
+		ID:        id,
+		Version:   pageData.Version,
+		DateModif: pageData.DateModif,
+	}
+	if err := db.setLocalContent(page, content); err != nil {
+		return err
+	}
+	updatedPage, err := co.UpdateContext(ctx, page, true)
+	if errors.Is(err, api.ErrNotFound) {
+		db.markDeletedRemotely(id)
+	}
+	if err != nil {
+		return fmt.Errorf("update page: %w", err)
+	}
+
+	syncedAt := time.Now()
+	if err := writeLocal(id, pageData.layout(), content); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	pageData.DateModif = updatedPage.DateModif
+	pageData.DateSync = syncedAt
+	pageData.Hash = hashContent(content)
+	pageData.Conflicted = false
+	db.setPage(id, pageData)
+	return saveBase(id, content)
+}
+
+// Three-way merge of local and server versions using last synced content as base.
+// If no hunks overlap, merged version is pushed and written locally.
+// Otherwise, an error of type api.ErrConflict is returned and nothing is changed.
+func (db *Database) mergePage(ctx context.Context, co *api.Client, id string) error {
+	pageData, exist := db.page(id)
+	if !exist {
+		return fmt.Errorf("ID not in database: %s", id)
+	}
+
+	base, err := loadBase(id)
+	if err != nil {
+		return fmt.Errorf("%w: %w", api.ErrConflict, err)
+	}
+
+	syncedAt := time.Now()
+	local, err := readLocal(id, pageData.layout())
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+
+	page, err := co.GetContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get page: %w", err)
+	}
+
+	merged, conflicts := merge3(base, local, db.localContent(page))
+	if conflicts > 0 {
+		return fmt.Errorf("%w: %d overlapping hunk(s)", api.ErrConflict, conflicts)
+	}
+
+	if err := db.setLocalContent(page, merged); err != nil {
+		return err
+	}
+	updatedPage, err := co.UpdateContext(ctx, page, false)
+	if err != nil {
+		return fmt.Errorf("update merged page: %w", err)
+	}
+
+	if err := writeLocal(id, pageData.layout(), merged); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	pageData.Version = page.Version
+	pageData.DateModif = updatedPage.DateModif
+	pageData.DateSync = syncedAt
+	pageData.Hash = hashContent(merged)
+	db.setPage(id, pageData)
+
+	return saveBase(id, merged)
+}
+
+// Write local and server versions in the local file, with conflicting hunks surrounded by markers.
+// Server version become the new base, so that the page can be pushed once resolved.
+func (db *Database) markConflict(ctx context.Context, co *api.Client, id string) error {
+	pageData, exist := db.page(id)
+	if !exist {
+		return fmt.Errorf("ID not in database: %s", id)
+	}
+
+	local, err := readLocal(id, pageData.layout())
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+
+	page, err := co.GetContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get page: %w", err)
+	}
+
+	base, err := loadBase(id)
+	if err != nil {
+		base = "" // without base, every difference is a conflict
+	}
+
+	server := db.localContent(page)
+	merged, _ := merge3(base, local, server)
+
+	pageData.Version = page.Version
+	pageData.DateModif = page.DateModif
+	pageData.DateSync = time.Now()
+	pageData.Hash = hashContent(server)
+	pageData.Conflicted = true
+	db.setPage(id, pageData)
+
+	if err := writeLocal(id, pageData.layout(), merged); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	return saveBase(id, server)
+}
+
+// mark conflict of page as resolved, once all conflict markers have been removed from local file
+func (db *Database) resolvePage(id string) error {
+	pageData, exist := db.page(id)
+	if !exist {
+		return fmt.Errorf("ID not in database: %s", id)
+	}
+
+	content, err := readLocal(id, pageData.layout())
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	if hasConflictMarkers(content) {
+		return fmt.Errorf("file still contains conflict markers")
+	}
+	if !pageData.Conflicted {
+		return fmt.Errorf("page is not in conflict")
+	}
+
+	pageData.Conflicted = false
+	db.setPage(id, pageData)
+	return nil
+}
+
+// Query the server once for given tracked pages modified since their last sync.
+// Pages deleted on the server are considered modified too.
+// Return the set of their IDs.
+func (db *Database) remotelyModified(ctx context.Context, co *api.Client, ids []string) (map[string]bool, error) {
+	modified := make(map[string]bool)
+
+	// server dates are used, as local sync dates can be later than server edits made during sync, or skewed
+	var oldest time.Time
+	tracked := false
+	for _, id := range ids {
+		pageData, exist := db.page(id)
+		if exist && (!tracked || pageData.DateModif.Before(oldest)) {
+			oldest = pageData.DateModif
+			tracked = true
+		}
+	}
+	if !tracked {
+		return modified, nil
+	}
+
+	options := api.DefaultOptions()
+	options.Fields = []string{"id", "datemodif"}
+	options.Since = oldest
+	pages, err := co.QueryContext(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("query modified pages: %w", err)
+	}
+
+	var missing []string
+	for _, id := range ids {
+		pageData, tracked := db.page(id)
+		if !tracked {
+			continue
+		}
+		page, exist := pages[id]
+		if !exist {
+			missing = append(missing, id)
+		} else if page.DateModif.After(pageData.DateModif) {
+			modified[id] = true
+		}
+	}
+	if len(missing) == 0 {
+		return modified, nil
+	}
+
+	// pages missing from query results were either not modified or deleted, compare with the list of existing pages
+	existing, err := co.ListContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list pages: %w", err)
+	}
+	for _, id := range missing {
+		if !slices.Contains(existing, id) {
+			modified[id] = true
+		}
+	}
+	return modified, nil
+}
+
+// Record current server modification date of every tracked page, without touching local files.
+// If content is true, server versions of remotely modified pages are stored too.
+// Return IDs of pages that were fetched.
+func (db *Database) fetch(ctx context.Context, co *api.Client, content bool) ([]string, error) {
+	options := api.DefaultOptions()
+	options.Fields = []string{"id", "datemodif"}
+	pages, err := co.QueryContext(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("query pages: %w", err)
+	}
+
+	var fetched []string
+	for _, id := range db.ids() {
+		pageData, _ := db.page(id)
+		page, exist := pages[id]
+		pageData.RemoteDeleted = !exist
+		if exist {
+			pageData.RemoteDateModif = page.DateModif
+			fetched = append(fetched, id)
+		}
+		db.setPage(id, pageData)
+	}
+	db.DateFetch = time.Now()
+	slices.Sort(fetched)
+
+	if !content {
+		return fetched, nil
+	}
+
+	for _, id := range fetched {
+		modified, _ := db.HasBeenModifiedRemotely(id)
+		if !modified {
+			if err := removeRemote(id); err != nil {
+				return fetched, err
+			}
+			continue
+		}
+		page, err := co.GetContext(ctx, id)
+		if err != nil {
+			return fetched, fmt.Errorf("get page %q: %w", id, err)
+		}
+		if err := saveRemote(id, db.localContent(page)); err != nil {
+			return fetched, err
+		}
+	}
+	return fetched, nil
+}
+
+type syncAction int
+
+const (
+	syncNone syncAction = iota
+	syncPushed
+	syncPulled
+	syncMerged
+	syncRestored
+	syncDeleted
+)
+
+type syncOptions struct {
+	checkRemote      bool // pull server modifications
+	propagateDeletes bool // delete on the server pages whose local file was deleted
+}
+
+// Push local modifications, then pull server modifications.
+// Pages whose local file was deleted are restored from the server, or deleted on the server.
+func (db *Database) syncPage(ctx context.Context, co *api.Client, id string, options syncOptions) (syncAction, error) {
+	if _, err := os.Stat(db.pagePath(id)); errors.Is(err, fs.ErrNotExist) {
+		if _, exist := db.page(id); !exist {
+			return syncNone, fmt.Errorf("untracked page")
+		}
+		if !options.propagateDeletes {
+			if err := db.restorePage(ctx, co, id); err != nil {
+				return syncNone, fmt.Errorf("restore deleted file: %w", err)
+			}
+			return syncRestored, nil
+		}
+		_, err := db.deleteRemotePage(ctx, co, id, false)
+		if errors.Is(err, api.ErrConflict) {
+			return syncNone, fmt.Errorf("propagate deletion: page was modified on server since last sync, use 'wsync -F remove --remote %s' to delete it anyway", id)
+		} else if err != nil {
+			return syncNone, fmt.Errorf("propagate deletion: %w", err)
+		}
+		if err := db.forgetPage(id); err != nil {
+			return syncNone, err
+		}
+		return syncDeleted, nil
+	}
+
+	pushed, pushErr := db.pushPage(ctx, co, id, false)
+	if errors.Is(pushErr, api.ErrConflict) {
+		if err := db.mergePage(ctx, co, id); err != nil {
+			return syncNone, err
+		}
+		return syncMerged, nil
+	}
 	if pushErr != nil {
-		return false, pushErr
+		return syncNone, pushErr
+	}
+	if !options.checkRemote {
+		if pushed {
+			return syncPushed, nil
+		}
+		return syncNone, nil
 	}
-	pulled, pullErr := db.pullPage(co, id, false)
+	pulled, pullErr := db.pullPage(ctx, co, id, false)
 	if pullErr != nil {
-		return false, pullErr
+		return syncNone, pullErr
 	}
 
-	return pushed || pulled, nil
+	switch {
+	case pulled:
+		return syncPulled, nil
+	case pushed:
+		return syncPushed, nil
+	default:
+		return syncNone, nil
+	}
 }
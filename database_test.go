@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+// minimal W server storing pages in memory, setting modification date on each update
+func newTestServer(t *testing.T, pages map[string]*api.Page) *api.Client {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/api/v0/pages/query" {
+			var options api.Options
+			if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			modified := make(map[string]*api.Page)
+			for id, page := range pages {
+				if !page.DateModif.Before(options.Since) {
+					modified[id] = page
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"pages": modified})
+			return
+		}
+		if r.URL.Path == "/api/v0/pages/list" {
+			ids := []string{}
+			for id := range pages {
+				ids = append(ids, id)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"pages": ids})
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/api/v0/page/")
+		id, action, _ := strings.Cut(path, "/")
+		page, exist := pages[id]
+		if !exist {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && action == "":
+		case r.Method == http.MethodPost && action == "update":
+			var updated api.Page
+			if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if page.DateModif.After(updated.DateModif) && r.URL.Query().Get("force") == "" {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			updated.DateModif = time.Now()
+			page = &updated
+			pages[id] = page
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return api.NewClient(server.URL)
+}
+
+func TestPushThenPull(t *testing.T) {
+	repoPath = t.TempDir()
+	synced := time.Now().Add(-time.Hour)
+	client := newTestServer(t, map[string]*api.Page{
+		"page": {ID: "page", Version: 2, Content: "old\n", DateModif: synced},
+	})
+
+	db := NewDatabase()
+	db.setPage("page", &PageData{Version: 2, DateModif: synced, DateSync: synced})
+	if err := os.WriteFile(GetPagePath("page"), []byte("new\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	pushed, err := db.pushPage(t.Context(), client, "page", false)
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if !pushed {
+		t.Fatal("local modification was not pushed")
+	}
+
+	pulled, err := db.pullPage(t.Context(), client, "page", false)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if pulled {
+		t.Error("page just pushed was pulled again")
+	}
+
+	modified, err := db.remotelyModified(t.Context(), client, []string{"page"})
+	if err != nil {
+		t.Fatalf("remotely modified: %v", err)
+	}
+	if modified["page"] {
+		t.Error("page just pushed is considered modified on server")
+	}
+}
+
+func TestForcePushUnchangedContent(t *testing.T) {
+	repoPath = t.TempDir()
+	synced := time.Now().Add(-time.Hour)
+	pages := map[string]*api.Page{
+		"page": {ID: "page", Version: 2, Content: "server\n", DateModif: synced.Add(time.Minute)},
+	}
+	client := newTestServer(t, pages)
+
+	db := NewDatabase()
+	db.setPage("page", &PageData{Version: 2, DateModif: synced, DateSync: synced, Hash: hashContent("base\n")})
+	if err := os.WriteFile(GetPagePath("page"), []byte("local\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	// user keeps last synced version while resolving the conflict
+	if err := db.forcePushPage(t.Context(), client, "page", "base\n"); err != nil {
+		t.Fatalf("force push: %v", err)
+	}
+	if pages["page"].Content != "base\n" {
+		t.Errorf("server content: got %q, want %q", pages["page"].Content, "base\n")
+	}
+	if content, _ := os.ReadFile(GetPagePath("page")); string(content) != "base\n" {
+		t.Errorf("local content: got %q, want %q", content, "base\n")
+	}
+	pulled, err := db.pullPage(t.Context(), client, "page", false)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if pulled {
+		t.Error("server version was pulled over pushed one")
+	}
+}
+
+func TestRemotelyModifiedDuringSync(t *testing.T) {
+	repoPath = t.TempDir()
+	synced := time.Now().Add(-time.Hour)
+	pages := map[string]*api.Page{
+		// edited on the server after the page was downloaded, but before sync date was recorded
+		"page":  {ID: "page", Version: 2, DateModif: synced.Add(time.Second)},
+		"other": {ID: "other", Version: 2, DateModif: synced},
+	}
+	client := newTestServer(t, pages)
+
+	db := NewDatabase()
+	db.setPage("page", &PageData{Version: 2, DateModif: synced, DateSync: synced.Add(time.Minute)})
+	db.setPage("other", &PageData{Version: 2, DateModif: synced, DateSync: synced.Add(time.Minute)})
+
+	modified, err := db.remotelyModified(t.Context(), client, []string{"page", "other"})
+	if err != nil {
+		t.Fatalf("remotely modified: %v", err)
+	}
+	if !modified["page"] {
+		t.Error("server edit made during sync was not detected")
+	}
+	if modified["other"] {
+		t.Error("page not edited on server is considered modified")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+const diffContext = 3
+
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+	colorBold  = "\033[1m"
+)
+
+func Diff(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	remote := flags.Bool("remote", false, "compare local files with current server versions")
+	flags.Parse(args)
+
+	database := LoadDatabase()
+
+	var client *api.Client
+	if *remote {
+		client = newClient(database)
+	}
+
+	var pages []string
+	if flags.NArg() > 0 {
+		pages = flags.Args()
+	} else if *remote {
+		pages = database.ids()
+	} else {
+		pages = database.EditedPages()
+	}
+	slices.Sort(pages)
+
+	colored := isTerminal(os.Stdout)
+
+	for _, id := range pages {
+		var diff string
+		var err error
+		if *remote {
+			diff, err = database.remoteDiff(ctx, client, id)
+			if errors.Is(err, api.ErrUnauthorized) {
+				unauthorized(ctx, database, client)
+				break
+			}
+		} else {
+			diff, err = database.localDiff(id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ could not diff page %q: %v\n", id, err)
+			continue
+		}
+		printDiff(diff, colored)
+	}
+}
+
+// diff between last synced version and local file
+func (db *Database) localDiff(id string) (string, error) {
+	if _, exist := db.page(id); !exist {
+		return "", fmt.Errorf("untracked page")
+	}
+	base, err := loadBase(id)
+	if err != nil {
+		return "", err
+	}
+	local, err := readLocal(id, db.layout(id))
+	if err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return pageDiff(id, "sync", "local", base, local, db.layout(id)), nil
+}
+
+// diff between current server version and local file
+func (db *Database) remoteDiff(ctx context.Context, co *api.Client, id string) (string, error) {
+	if _, exist := db.page(id); !exist {
+		return "", fmt.Errorf("untracked page")
+	}
+	page, err := co.GetContext(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("get page: %w", err)
+	}
+	local, err := readLocal(id, db.layout(id))
+	if err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return pageDiff(id, "server", "local", db.localContent(page), local, db.layout(id)), nil
+}
+
+// check if file is a terminal, to decide if output should be colored
+func isTerminal(file *os.File) bool {
+	return term.IsTerminal(file.Fd())
+}
+
+func printDiff(diff string, colored bool) {
+	if !colored {
+		fmt.Print(diff)
+		return
+	}
+	// lines left in current hunk, so that changed lines starting with "--" or "++" are not taken for file headers
+	var oldLeft, newLeft int
+	for _, line := range splitLines(diff) {
+		var color string
+		inHunk := oldLeft > 0 || newLeft > 0
+		switch {
+		case !inHunk && (strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++")):
+			color = colorBold
+		case !inHunk && strings.HasPrefix(line, "@@"):
+			color = colorCyan
+			fmt.Sscanf(line, "@@ -%d,%d +%d,%d @@", new(int), &oldLeft, new(int), &newLeft)
+		case strings.HasPrefix(line, "-"):
+			color = colorRed
+			oldLeft--
+		case strings.HasPrefix(line, "+"):
+			color = colorGreen
+			newLeft--
+		case strings.HasPrefix(line, " "):
+			oldLeft--
+			newLeft--
+		}
+		if color == "" {
+			fmt.Print(line)
+		} else {
+			fmt.Print(color + strings.TrimSuffix(line, "\n") + colorReset + "\n")
+		}
+	}
+}
+
+// Unified diff between two versions of a page.
+// Pages stored in several files are compared file by file.
+func pageDiff(id, oldPrefix, newPrefix, oldText, newText string, l layout) string {
+	if !l.joined() {
+		return unifiedDiff(oldPrefix+"/"+id, newPrefix+"/"+id, oldText, newText)
+	}
+	parts := l.parts(id)
+	oldContents, oldErr := splitParts(parts, oldText)
+	newContents, newErr := splitParts(parts, newText)
+	if oldErr != nil || newErr != nil {
+		return unifiedDiff(oldPrefix+"/"+id, newPrefix+"/"+id, oldText, newText)
+	}
+
+	var sb strings.Builder
+	for _, p := range parts {
+		file := filepath.ToSlash(p.file)
+		sb.WriteString(unifiedDiff(oldPrefix+"/"+file, newPrefix+"/"+file, oldContents[p.name], newContents[p.name]))
+	}
+	return sb.String()
+}
+
+// Unified diff between two texts, with diffContext lines of context around changes.
+// Return an empty string if texts are identical.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	edits := diffLines(a, b)
+
+	// group changes that are close enough into hunks of edits
+	var hunks [][2]int
+	for i, e := range edits {
+		if e.Op == opEqual {
+			continue
+		}
+		start := max(i-diffContext, 0)
+		end := min(i+diffContext+1, len(edits))
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1][1] {
+			hunks[len(hunks)-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range hunks {
+		hunkEdits := edits[hunk[0]:hunk[1]]
+		var oldCount, newCount int
+		for _, e := range hunkEdits {
+			if e.Op != opInsert {
+				oldCount++
+			}
+			if e.Op != opDelete {
+				newCount++
+			}
+		}
+		oldStart, newStart := hunkEdits[0].A, hunkEdits[0].B
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+
+		for _, e := range hunkEdits {
+			var prefix, line string
+			switch e.Op {
+			case opEqual:
+				prefix, line = " ", a[e.A]
+			case opDelete:
+				prefix, line = "-", a[e.A]
+			case opInsert:
+				prefix, line = "+", b[e.B]
+			}
+			sb.WriteString(prefix + line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+func Fetch(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	content := flags.Bool("content", false, "also store server versions of remotely modified pages")
+	flags.Parse(args)
+
+	database := LoadDatabase()
+	client := newClient(database)
+
+	fetched, err := database.fetch(ctx, client, *content)
+	if fetched == nil && err != nil {
+		fatalRequest(ctx, database, client, "❌ could not fetch:", err)
+	} else if err != nil {
+		fmt.Println("❌ could not fetch content:", err)
+	}
+
+	var behind []string
+	for _, id := range fetched {
+		if modified, _ := database.HasBeenModifiedRemotely(id); modified {
+			behind = append(behind, id)
+		}
+	}
+	fmt.Printf("📡 fetched %d tracked page(s), %d modified on server %v\n", len(fetched), len(behind), behind)
+
+	SaveDatabase(database)
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/huh"
 	"github.com/vincent-peugnet/wsync/api"
 )
@@ -57,67 +66,470 @@ func parseVersion(version string) (*ParsedVersion, error) {
 	return &v, nil
 }
 
+// pages to process: provided IDs or all tracked pages, sorted and without duplicates
+func selectPages(db *Database, args []string) []string {
+	var pages []string
+	if len(args) > 0 {
+		pages = slices.Clone(args)
+	} else {
+		pages = db.ids()
+	}
+	slices.Sort(pages)
+	return slices.Compact(pages)
+}
+
+// Query the server to only keep tracked pages that were modified remotely.
+// Untracked pages are kept so that they can be reported.
+// If query fails, all pages are kept and will be checked one by one.
+func filterRemotelyModified(ctx context.Context, db *Database, client *api.Client, pages []string) []string {
+	modified, err := db.remotelyModified(ctx, client, pages)
+	if errors.Is(err, api.ErrUnauthorized) {
+		fatalRequest(ctx, db, client, err)
+	} else if err != nil {
+		fmt.Printf("⚠️  %v, checking pages one by one\n", err)
+		return pages
+	}
+	return slices.DeleteFunc(pages, func(id string) bool {
+		_, tracked := db.page(id)
+		return tracked && !modified[id]
+	})
+}
+
+// Process pages using a pool of workers, its size is set by jobs flag.
+// Results are handled in the same order as pages, as soon as they are available.
+// Once context is canceled, remaining pages are skipped.
+func processPages[T any](ctx context.Context, pages []string, process func(id string) T, handle func(id string, result T)) {
+	results := make([]chan T, len(pages))
+	for i := range results {
+		results[i] = make(chan T, 1)
+	}
+
+	queue := make(chan int)
+	for range max(jobs, 1) {
+		go func() {
+			for i := range queue {
+				results[i] <- process(pages[i])
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for i := range pages {
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				for _, result := range results[i:] {
+					close(result)
+				}
+				return
+			}
+		}
+	}()
+
+	var skipped int
+	for i, id := range pages {
+		result, processed := <-results[i]
+		if !processed {
+			skipped++
+			continue
+		}
+		handle(id, result)
+	}
+	if skipped > 0 {
+		fmt.Printf("🛑 interrupted, %d page(s) were not processed\n", skipped)
+	}
+}
+
 func GetPagePath(id string) string {
 	filename := id + ".md"
 	return filepath.Join(repoPath, filename)
 }
 
-func SaveToken(token string) {
-	filename := filepath.Join(repoPath, TokenPath)
-	if err := os.MkdirAll(filepath.Dir(filename), 0775); err != nil {
-		log.Fatalln("save token:", err)
+// directory of a version 1 page stored with one file per element
+func GetPageDir(id string) string {
+	return filepath.Join(repoPath, id)
+}
+
+// path of the last synced version of a page, used as base for three-way merges
+func GetBasePath(id string) string {
+	filename := id + ".md"
+	return filepath.Join(repoPath, BasePath, filename)
+}
+
+// path of the server version of a page, as fetched
+func GetRemotePath(id string) string {
+	filename := id + ".md"
+	return filepath.Join(repoPath, RemotePath, filename)
+}
+
+// hash of a file content, read without loading it entirely in memory
+func hashFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("read file: %w", err)
 	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// format strings as a quoted comma separated list
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return strings.Join(quoted, ", ")
+}
 
-	if err := os.WriteFile(filename, []byte(token), 0640); err != nil {
+// hash used to detect content changes
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func SaveToken(db *Database, token string) {
+	if err := db.tokenStore().save(token); err != nil {
 		log.Fatalln("save token:", err)
 	}
 }
 
-func LoadToken() string {
-	filename := filepath.Join(repoPath, TokenPath)
-	token, err := os.ReadFile(filename)
+// load stored token, empty if logged out
+func LoadToken(db *Database) string {
+	token, err := db.tokenStore().load()
 	if err != nil {
 		log.Fatalln("load token:", err)
 	}
-	return string(token)
+	return token
+}
+
+// delete stored token, return false if there was none
+func DeleteToken(db *Database) bool {
+	deleted, err := db.tokenStore().delete()
+	if err != nil {
+		log.Fatalln("delete token:", err)
+	}
+	return deleted
+}
+
+// API client for the repository server, authenticated with stored token
+func newClient(db *Database) *api.Client {
+	client := newAnonymousClient(db)
+	client.Token = LoadToken(db)
+	return client
+}
+
+// API client for the repository server, without authentication token
+func newAnonymousClient(db *Database) *api.Client {
+	client := api.NewClient(db.Config.BaseURL)
+	if db.Config.Timeout > 0 {
+		client.Timeout = db.Config.Timeout
+	}
+	if db.Config.Retries != nil {
+		client.Retry.MaxRetries = *db.Config.Retries
+	}
+	if db.Config.RetryDelay > 0 {
+		client.Retry.BaseDelay = db.Config.RetryDelay
+		client.Retry.MaxDelay = max(client.Retry.MaxDelay, db.Config.RetryDelay)
+	}
+	return client
+}
+
+// Ask user for credentials and get a new authentication token from the server.
+// Username field is pre-filled with given username.
+func login(ctx context.Context, client *api.Client, username string) (string, error) {
+	var password string
+
+	credentialForm := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Username").
+				Value(&username),
+			huh.NewInput().
+				EchoMode(huh.EchoMode(textinput.EchoPassword)).
+				Title("Password").
+				Value(&password),
+		),
+	)
+
+	if err := credentialForm.Run(); err != nil {
+		return "", err
+	}
+
+	return client.AuthContext(ctx, username, password)
 }
 
-func conflict(db *Database, client *api.Client, id string) {
+// Check the error returned by a prompt.
+// When user aborted it, interactive mode is turned off so that remaining prompts are skipped.
+func promptAborted(err error) bool {
+	if errors.Is(err, huh.ErrUserAborted) {
+		interactive = false
+		return true
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return false
+}
+
+// Report that server rejected the authentication token, as it expired or was revoked.
+// In interactive mode, user is asked to log in again, so that the command can be run again.
+func unauthorized(ctx context.Context, db *Database, client *api.Client) {
+	if client.Token == "" {
+		fmt.Println("🔑 not logged in")
+	} else {
+		fmt.Println("🔑 server rejected authentication token, it may have expired")
+	}
+	if db.tokenReadOnly() {
+		fmt.Printf("💡 set %s environment variable to a valid token\n", TokenEnv)
+		return
+	}
+	if !interactive || ctx.Err() != nil {
+		fmt.Println("💡 run 'wsync login' to log in again")
+		return
+	}
+
+	var confirm bool
+	confirmForm := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Log in again ?").
+				Value(&confirm),
+		),
+	)
+	if promptAborted(confirmForm.Run()) || !confirm {
+		return
+	}
+
+	token, err := login(ctx, client, "")
+	if err != nil {
+		fmt.Println("❌ could not log in:", err)
+		return
+	}
+	SaveToken(db, token)
+	client.Token = token
+	fmt.Println("🔓️ logged in, run the command again to process remaining items")
+}
+
+// Exit because a request failed.
+// If server rejected the authentication token, user is offered to log in again.
+func fatalRequest(ctx context.Context, db *Database, client *api.Client, v ...any) {
+	if err, ok := v[len(v)-1].(error); ok && errors.Is(err, api.ErrUnauthorized) {
+		unauthorized(ctx, db, client)
+		os.Exit(1)
+	}
+	log.Fatalln(v...)
+}
+
+func conflict(ctx context.Context, db *Database, client *api.Client, id string) {
+	if !interactive {
+		fmt.Printf("⏭️  conflict for page %q skipped, it will be prompted again on next sync\n", id)
+		return
+	}
+	for {
+		var action string
+		form := huh.NewForm(
+			huh.NewGroup(
+				huh.NewSelect[string]().
+					Title(fmt.Sprintf("Which version of %q should be kept ?", id)).
+					Description(fmt.Sprintf("⚠️  compare the two versions before choosing (wsync diff --remote %s)", id)).
+					Options(
+						huh.NewOption("Show diff", "diff"),
+						huh.NewOption("Both (keep conflict)", "both"),
+						huh.NewOption("Server (force pull)", "server"),
+						huh.NewOption("Local (force push)", "local"),
+						huh.NewOption("Edit merged version in $EDITOR (force push)", "edit"),
+					).
+					Value(&action),
+			),
+		)
+		if promptAborted(form.Run()) {
+			fmt.Printf("⏭️  conflict for page %q skipped, it will be prompted again on next sync\n", id)
+			return
+		}
+
+		switch action {
+		case "diff":
+			if err := conflictDiff(ctx, db, client, id); err != nil {
+				fmt.Printf("❌  conflict for page %q: error while trying to show diff: %v\n", id, err)
+			}
+			continue
+		case "edit":
+			edited, err := editMerged(ctx, db, client, id)
+			if err != nil {
+				fmt.Printf("❌  conflict for page %q: error while trying to edit merged version: %v\n", id, err)
+				continue
+			} else if !edited {
+				fmt.Printf("↩️  conflict for page %q: merged version was not saved\n", id)
+				continue
+			}
+			fmt.Printf("⬆️  conflict for page %q: merged version successfully force pushed\n", id)
+		case "server":
+			_, err := db.pullPage(ctx, client, id, true)
+			if err != nil {
+				fmt.Printf("❌  conflict for page %q: error while trying to force pull: %v\n", id, err)
+			} else {
+				fmt.Printf("⬇️  conflict for page %q: successfully force pulled\n", id)
+			}
+		case "local":
+			// pushed even if identical to last synced version, so that it replaces server one
+			local, err := readLocal(id, db.layout(id))
+			if err == nil {
+				err = db.forcePushPage(ctx, client, id, local)
+			}
+			if err != nil {
+				fmt.Printf("❌  conflict for page %q: error while trying to force push: %v\n", id, err)
+			} else {
+				fmt.Printf("⬆️  conflict for page %q: successfully force pushed\n", id)
+			}
+		default:
+			if err := db.markConflict(ctx, client, id); err != nil {
+				fmt.Printf("❌  conflict for page %q: error while trying to write conflict markers: %v\n", id, err)
+			} else {
+				fmt.Printf("⚔️  conflict for page %q: both version kept in %s, fix the file then run 'wsync resolve %s'\n", id, quoteList(db.conflictedPaths(id)), id)
+			}
+		}
+		return
+	}
+}
+
+// report the outcome of removePage
+func printRemoved(id string, path string, fileDeleted bool) {
+	if fileDeleted {
+		fmt.Printf("🗑️  removed page %q and deleted local associated file\n", id)
+	} else if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("🗑️  removed page %q, its local file was already deleted\n", id)
+	} else {
+		fmt.Printf("🛡️  untracked page %q, but kept %q file because of local modifications\n", id, path)
+	}
+}
+
+// let user choose what to do with a page that was deleted on the server
+func deletedRemotely(db *Database, id string) {
+	if !interactive {
+		fmt.Printf("🗑️  page %q was deleted on server, run 'wsync remove %s' to untrack it\n", id, id)
+		return
+	}
 	var action string
 	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewSelect[string]().
-				Title(fmt.Sprintf("Which version of %q should be kept ?", id)).
-				Description("⚠️  compare the two versions before choosing").
+				Title(fmt.Sprintf("Page %q was deleted on the server, what to do ?", id)).
 				Options(
-					huh.NewOption("Both (keep conflict)", "both"),
-					huh.NewOption("Server (force pull)", "server"),
-					huh.NewOption("Local (force push)", "local"),
+					huh.NewOption("Untrack and delete local file (kept if localy edited)", "remove"),
+					huh.NewOption("Keep local file as untracked", "untrack"),
+					huh.NewOption("Nothing (ask again on next sync)", "nothing"),
 				).
 				Value(&action),
 		),
 	)
-	err := form.Run()
-	if err != nil {
-		log.Fatal(err)
+	if promptAborted(form.Run()) {
+		fmt.Printf("🗑️  page %q was deleted on server, run 'wsync remove %s' to untrack it\n", id, id)
+		return
 	}
 
+	path := db.pagePath(id)
 	switch action {
-	case "server":
-		_, err := db.pullPage(client, id, true)
+	case "remove":
+		fileDeleted, err := db.removePage(id)
 		if err != nil {
-			fmt.Printf("❌  conflict for page %q: error while trying to force pull: %v\n", id, err)
+			fmt.Printf("❌ error while removing %q: %v\n", id, err)
 		} else {
-			fmt.Printf("⬇️  conflict for page %q: successfully force pulled\n", id)
+			printRemoved(id, path, fileDeleted)
 		}
-	case "local":
-		_, err := db.pushPage(client, id, true)
-		if err != nil {
-			fmt.Printf("❌  conflict for page %q: error while trying to force push: %v\n", id, err)
+	case "untrack":
+		if err := db.forgetPage(id); err != nil {
+			fmt.Printf("❌ error while untracking %q: %v\n", id, err)
 		} else {
-			fmt.Printf("⬆️  conflict for page %q: successfully force pushed\n", id)
+			fmt.Printf("🛡️  untracked page %q, kept %q file\n", id, path)
 		}
 	default:
-		fmt.Printf("⚔️  conflict for page %q: both version kept\n", id)
+		fmt.Printf("🗑️  page %q was deleted on server, nothing done\n", id)
+	}
+}
+
+// open the diff viewer with local and server versions of the page
+func conflictDiff(ctx context.Context, db *Database, client *api.Client, id string) error {
+	local, err := readLocal(id, db.layout(id))
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	page, err := client.GetContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get page: %w", err)
+	}
+	return showDiff(id, local, db.localContent(page))
+}
+
+// Open a temporary file pre-filled with conflict markers in user's editor.
+// Once saved, merged version is force pushed, then written locally.
+// Return whether the file was saved.
+func editMerged(ctx context.Context, db *Database, client *api.Client, id string) (bool, error) {
+	local, err := readLocal(id, db.layout(id))
+	if err != nil {
+		return false, fmt.Errorf("read file: %w", err)
+	}
+	page, err := client.GetContext(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("get page: %w", err)
+	}
+	base, err := loadBase(id)
+	if err != nil {
+		base = "" // without base, every difference is a conflict
+	}
+	merged, _ := merge3(base, local, db.localContent(page))
+
+	file, err := os.CreateTemp("", id+".*.md")
+	if err != nil {
+		return false, fmt.Errorf("create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(merged); err != nil {
+		file.Close()
+		return false, fmt.Errorf("write temporary file: %w", err)
+	}
+	file.Close()
+
+	if err := runEditor(file.Name()); err != nil {
+		return false, err
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return false, fmt.Errorf("read temporary file: %w", err)
+	}
+	if string(edited) == merged {
+		return false, nil
+	}
+	if hasConflictMarkers(string(edited)) {
+		return false, fmt.Errorf("merged version still contains conflict markers")
+	}
+
+	if err := db.forcePushPage(ctx, client, id, string(edited)); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// open file in the editor defined by $VISUAL or $EDITOR, default to vi
+func runEditor(filename string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], filename)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run editor: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+const frontMatterDelimiter = "---"
+
+// page metadata stored in YAML front matter, in writing order
+var frontMatterKeys = []string{"title", "description", "lang", "tags", "secure", "redirection"}
+
+// local content of a page, with a front matter block if enabled, and parts joined if stored in several files
+func (db *Database) localContent(page *api.Page) string {
+	primary := page.Primary()
+	if db.Config.FrontMatter {
+		primary = renderFrontMatter(page) + primary
+	}
+	l := db.pageLayout(page)
+	if !l.joined() {
+		return primary
+	}
+	parts := l.parts(page.ID)
+	contents := make(map[string]string)
+	for _, p := range parts {
+		contents[p.name] = partContent(page, p.name)
+	}
+	contents["main"] = primary
+	return joinParts(parts, contents)
+}
+
+// set primary content of a page, and metadata found in front matter if enabled
+func (db *Database) setLocalContent(page *api.Page, content string) error {
+	if l := db.pageLayout(page); l.joined() {
+		contents, err := splitParts(l.parts(page.ID), content)
+		if err != nil {
+			return err
+		}
+		applyParts(page, l, contents)
+		content = contents["main"]
+	}
+	if !db.Config.FrontMatter {
+		// a block left from when the setting was enabled would end up in page content
+		if fields, _, err := splitFrontMatter(content); err == nil && onlyFrontMatterKeys(fields) {
+			return fmt.Errorf("content starts with a front matter block while frontmatter setting is disabled, remove it or run 'wsync config frontmatter true'")
+		}
+		page.SetPrimary(content)
+		return nil
+	}
+	fields, primary, err := splitFrontMatter(content)
+	if err != nil {
+		return err
+	}
+	if err := applyFrontMatter(page, fields); err != nil {
+		return err
+	}
+	page.SetPrimary(primary)
+	return nil
+}
+
+// Check if fields look like a block written by renderFrontMatter.
+// Markdown can start with lines parsed as front matter, like a thematic break followed by a line containing a colon.
+func onlyFrontMatterKeys(fields map[string]any) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	for key := range fields {
+		if !slices.Contains(frontMatterKeys, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// Render page metadata as a YAML front matter block.
+// Values are encoded as JSON, which is valid YAML, without escaping HTML characters so that they stay readable.
+func renderFrontMatter(page *api.Page) string {
+	var sb strings.Builder
+	var encoded strings.Builder
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	sb.WriteString(frontMatterDelimiter + "\n")
+	for _, key := range frontMatterKeys {
+		var value any
+		switch key {
+		case "title":
+			value = page.Title
+		case "description":
+			value = page.Description
+		case "lang":
+			value = page.Lang
+		case "tags":
+			value = page.Tag
+			if page.Tag == nil {
+				value = []string{}
+			}
+		case "secure":
+			if page.Secure == nil {
+				continue
+			}
+			value = *page.Secure
+		case "redirection":
+			value = page.Redirection
+		}
+		encoded.Reset()
+		encoder.Encode(value) // followed by a newline
+		sb.WriteString(key + ": " + encoded.String())
+	}
+	sb.WriteString(frontMatterDelimiter + "\n")
+	return sb.String()
+}
+
+// Separate front matter from content.
+// Front matter values are returned as raw strings or as slices for sequences.
+// If content does not start with a front matter block, fields are nil.
+func splitFrontMatter(content string) (map[string]any, string, error) {
+	if !strings.HasPrefix(content, frontMatterDelimiter+"\n") && !strings.HasPrefix(content, frontMatterDelimiter+"\r\n") {
+		return nil, content, nil
+	}
+
+	lines := splitLines(content)
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], "\r\n") == frontMatterDelimiter {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, "", fmt.Errorf("front matter: missing closing %q", frontMatterDelimiter)
+	}
+
+	fields, err := parseFrontMatter(lines[1:end])
+	if err != nil {
+		return nil, "", err
+	}
+	return fields, strings.Join(lines[end+1:], ""), nil
+}
+
+// parse the subset of YAML used by front matter: scalars, flow and block sequences
+func parseFrontMatter(lines []string) (map[string]any, error) {
+	fields := make(map[string]any)
+	var sequenceKey string
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if item, isItem := strings.CutPrefix(trimmed, "- "); isItem || trimmed == "-" {
+			if !isItem {
+				item = "" // empty item
+			}
+			if sequenceKey == "" {
+				return nil, fmt.Errorf("front matter line %d: sequence item without key", i+2)
+			}
+			value, err := parseScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("front matter line %d: %w", i+2, err)
+			}
+			fields[sequenceKey] = append(fields[sequenceKey].([]string), value)
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found || strings.HasPrefix(line, " ") {
+			return nil, fmt.Errorf("front matter line %d: expected 'key: value'", i+2)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		sequenceKey = ""
+
+		switch {
+		case value == "":
+			sequenceKey = key // block sequence may follow
+			fields[key] = []string{}
+		case strings.HasPrefix(value, "["):
+			items, err := parseFlowSequence(value)
+			if err != nil {
+				return nil, fmt.Errorf("front matter line %d: %w", i+2, err)
+			}
+			fields[key] = items
+		default:
+			scalar, err := parseScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("front matter line %d: %w", i+2, err)
+			}
+			fields[key] = scalar
+		}
+	}
+	return fields, nil
+}
+
+func parseFlowSequence(value string) ([]string, error) {
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unclosed sequence %s", value)
+	}
+	inner := strings.TrimSpace(value[1 : len(value)-1])
+	items := []string{}
+	if inner == "" {
+		return items, nil
+	}
+	for _, item := range splitFlowItems(inner) {
+		scalar, err := parseScalar(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, scalar)
+	}
+	return items, nil
+}
+
+// split sequence items on commas that are not inside quotes
+func splitFlowItems(inner string) []string {
+	var items []string
+	var quote rune
+	escaped := false
+	start := 0
+	for i, r := range inner {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0 // doubled single quote reopens it right away
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, inner[start:])
+}
+
+func parseScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		var s string
+		if err := json.Unmarshal([]byte(value), &s); err != nil {
+			return "", fmt.Errorf("invalid double quoted string %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid single quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	default:
+		if comment := strings.Index(value, " #"); comment != -1 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		return value, nil
+	}
+}
+
+// Set page metadata from front matter fields.
+// Fields left empty are explicitly sent, so that they are cleared on the server.
+func applyFrontMatter(page *api.Page, fields map[string]any) error {
+	for key, value := range fields {
+		text, isText := value.(string)
+		if list, isList := value.([]string); isList && len(list) == 0 {
+			text, isText = "", true // key without value
+		}
+		switch key {
+		case "title", "description", "lang", "redirection":
+			if !isText {
+				return fmt.Errorf("front matter: %s should be a string", key)
+			}
+			switch key {
+			case "title":
+				page.Title = text
+			case "description":
+				page.Description = text
+			case "lang":
+				page.Lang = text
+			case "redirection":
+				page.Redirection = text
+			}
+			if text == "" {
+				sendEmpty(page, key, `""`)
+			}
+		case "tags":
+			tags, isList := value.([]string)
+			if !isList {
+				return fmt.Errorf("front matter: tags should be a list")
+			}
+			page.Tag = tags
+			if len(tags) == 0 {
+				sendEmpty(page, "tag", `[]`)
+			}
+		case "secure":
+			secure, err := strconv.Atoi(text)
+			if !isText || err != nil {
+				return fmt.Errorf("front matter: secure should be a number")
+			}
+			page.Secure = &secure
+		default:
+			return fmt.Errorf("front matter: unknown key %q", key)
+		}
+	}
+	return nil
+}
+
+// Explicitly send an empty value for a field, so that it is cleared on the server.
+// Empty fields of Page are otherwise omitted.
+func sendEmpty(page *api.Page, key string, empty string) {
+	if page.Extra == nil {
+		page.Extra = make(map[string]json.RawMessage)
+	}
+	page.Extra[key] = json.RawMessage(empty)
+}
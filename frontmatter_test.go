@@ -0,0 +1,221 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		fields  map[string]any
+		primary string
+		err     string
+	}{
+		{
+			name:    "without front matter",
+			content: "# Title\n---\ntext\n",
+			primary: "# Title\n---\ntext\n",
+		},
+		{
+			name:    "scalars",
+			content: "---\ntitle: \"My page\"\nlang: en # comment\nsecure: 1\ndescription:\n---\ntext\n",
+			fields:  map[string]any{"title": "My page", "lang": "en", "secure": "1", "description": []string{}},
+			primary: "text\n",
+		},
+		{
+			name:    "windows line endings",
+			content: "---\r\ntitle: \"My page\"\r\n---\r\ntext\r\n",
+			fields:  map[string]any{"title": "My page"},
+			primary: "text\r\n",
+		},
+		{
+			name:    "quoted commas in flow sequence",
+			content: "---\ntags: [draft, \"a, b\", 'c, d']\n---\n",
+			fields:  map[string]any{"tags": []string{"draft", "a, b", "c, d"}},
+		},
+		{
+			name:    "empty flow sequence",
+			content: "---\ntags: []\n---\n",
+			fields:  map[string]any{"tags": []string{}},
+		},
+		{
+			name:    "single quote escapes",
+			content: "---\ntitle: 'it''s mine'\ntags: ['it''s, ok', \"say \\\"hi\\\"\"]\n---\n",
+			fields:  map[string]any{"title": "it's mine", "tags": []string{"it's, ok", `say "hi"`}},
+		},
+		{
+			name:    "block sequence",
+			content: "---\ntags:\n  - one\n  - \"two, three\"\n  - 'four'\ntitle: \"after\"\n---\ntext\n",
+			fields:  map[string]any{"tags": []string{"one", "two, three", "four"}, "title": "after"},
+			primary: "text\n",
+		},
+		{
+			name:    "empty block sequence item",
+			content: "---\ntags:\n  -\n  - one\n---\n",
+			fields:  map[string]any{"tags": []string{"", "one"}},
+		},
+		{
+			name:    "missing closing delimiter",
+			content: "---\ntitle: \"My page\"\ntext\n",
+			err:     "missing closing",
+		},
+		{
+			name:    "sequence item without key",
+			content: "---\n- one\n---\n",
+			err:     "sequence item without key",
+		},
+		{
+			name:    "line without key",
+			content: "---\njust text\n---\n",
+			err:     "expected 'key: value'",
+		},
+		{
+			name:    "unclosed flow sequence",
+			content: "---\ntags: [a, b\n---\n",
+			err:     "unclosed sequence",
+		},
+		{
+			name:    "invalid quoted string",
+			content: "---\ntitle: \"unfinished\n---\n",
+			err:     "invalid double quoted string",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, primary, err := splitFrontMatter(test.content)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want error containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(fields, test.fields) && (len(fields) > 0 || len(test.fields) > 0) {
+				t.Errorf("fields: got %#v, want %#v", fields, test.fields)
+			}
+			if primary != test.primary {
+				t.Errorf("primary: got %q, want %q", primary, test.primary)
+			}
+		})
+	}
+}
+
+func TestFrontMatterRoundTrip(t *testing.T) {
+	public, private := 0, 1
+	pages := []*api.Page{
+		{
+			ID:          "full",
+			Version:     2,
+			Content:     "# Title\n\ntext\n",
+			Title:       "Title: with \"quotes\", 'single quotes' and # hash",
+			Description: "multi\nline, with commas",
+			Lang:        "fr",
+			Tag:         []string{"draft", "a, b", "it's", `say "hi"`, "[bracket]"},
+			Secure:      &private,
+			Redirection: "https://example.com/?a=1#b",
+		},
+		{
+			ID:      "empty",
+			Version: 2,
+			Content: "---\nnot front matter\n",
+			Secure:  &public,
+		},
+		{
+			ID:      "version1",
+			Version: 1,
+			Main:    "main content",
+			Title:   "éàü ✓",
+			Tag:     []string{"one"},
+		},
+		{
+			ID:      "html",
+			Version: 2,
+			Title:   "Q&A <draft>",
+			Tag:     []string{"<b>", "a&b"},
+		},
+	}
+	for _, page := range pages {
+		t.Run(page.ID, func(t *testing.T) {
+			content := renderFrontMatter(page) + page.Primary()
+			if strings.Contains(content, `\u`) {
+				t.Errorf("characters escaped in front matter:\n%s", content)
+			}
+			fields, primary, err := splitFrontMatter(content)
+			if err != nil {
+				t.Fatalf("parse rendered front matter: %v\n%s", err, content)
+			}
+			if primary != page.Primary() {
+				t.Errorf("primary: got %q, want %q", primary, page.Primary())
+			}
+
+			parsed := &api.Page{ID: page.ID, Version: page.Version}
+			if err := applyFrontMatter(parsed, fields); err != nil {
+				t.Fatalf("apply front matter: %v", err)
+			}
+			for _, key := range frontMatterKeys {
+				got, want := frontMatterValue(parsed, key), frontMatterValue(page, key)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %#v, want %#v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetLocalContentWithoutFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		refused bool
+	}{
+		{"plain text", "# Title\n\ntext\n", false},
+		{"markdown looking like front matter", "---\nWarning: this page is deprecated\n---\n", false},
+		{"front matter block", "---\ntitle: \"My page\"\ntags: []\n---\ntext\n", true},
+	}
+	db := NewDatabase()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page := &api.Page{ID: "page", Version: 2}
+			err := db.setLocalContent(page, test.content)
+			if refused := err != nil; refused != test.refused {
+				t.Fatalf("got error %v, want refused %t", err, test.refused)
+			}
+			if !test.refused && page.Content != test.content {
+				t.Errorf("content: got %q, want %q", page.Content, test.content)
+			}
+		})
+	}
+}
+
+// value of a page field stored in front matter, with missing values normalized
+func frontMatterValue(page *api.Page, key string) any {
+	switch key {
+	case "title":
+		return page.Title
+	case "description":
+		return page.Description
+	case "lang":
+		return page.Lang
+	case "tags":
+		if len(page.Tag) == 0 {
+			return []string{}
+		}
+		return page.Tag
+	case "secure":
+		if page.Secure == nil {
+			return -1
+		}
+		return *page.Secure
+	case "redirection":
+		return page.Redirection
+	default:
+		panic("unknown front matter key " + key)
+	}
+}
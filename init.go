@@ -1,18 +1,60 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
-	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/huh"
 	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Init(args []string) {
+func Init(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	url := flags.String("url", "", "URL where W is installed")
+	username := flags.String("username", "", "username used to log in")
+	passwordStdin := flags.Bool("password-stdin", false, "read password from standard input")
+	tokenFile := flags.String("token-file", "", "read authentication token from file instead of logging in")
+	yes := flags.Bool("yes", false, "do not ask to confirm use of the folder")
+	credentials := flags.String("credentials", CredentialsFile, "where the authentication token is stored: "+strings.Join(credentialStores, ", "))
+	flags.Parse(args)
+
+	if *passwordStdin && *tokenFile != "" {
+		log.Fatalln("❌ --password-stdin and --token-file can not be used together")
+	}
+	if *passwordStdin && *username == "" {
+		log.Fatalln("❌ --password-stdin requires --username")
+	}
+	// as password is read from standard input, nothing else can be asked
+	if *passwordStdin && !*yes {
+		log.Fatalln("❌ --password-stdin requires --yes, as use of the folder can not be confirmed")
+	}
+	if *passwordStdin && *url == "" && flags.NArg() == 0 {
+		log.Fatalln("❌ --password-stdin requires --url, as it can not be asked")
+	}
+	if !slices.Contains(credentialStores, *credentials) {
+		log.Fatalf("❌ --credentials should be one of %s", strings.Join(credentialStores, ", "))
+	}
+	// with env credentials, token is not obtained by logging in
+	envToken := *credentials == CredentialsEnv
+	if envToken && (*passwordStdin || *tokenFile != "") {
+		log.Fatalf("❌ --password-stdin and --token-file can not be used with --credentials %s, set %s environment variable instead", CredentialsEnv, TokenEnv)
+	}
+	// forms can only be shown when standard input is a terminal
+	canAsk := !*passwordStdin && isTerminal(os.Stdin)
+	if !canAsk && !*passwordStdin && *tokenFile == "" && !envToken {
+		log.Fatalln("❌ standard input is not a terminal: use --username with --password-stdin, or --token-file to log in")
+	}
+	if !canAsk && *credentials == CredentialsEncrypted && os.Getenv(PassphraseEnv) == "" {
+		log.Fatalf("❌ standard input is not a terminal: set %s environment variable to use --credentials %s", PassphraseEnv, CredentialsEncrypted)
+	}
 
 	files, err := os.ReadDir(repoPath)
 	if err != nil {
@@ -28,24 +70,35 @@ func Init(args []string) {
 		log.Fatalln(err)
 	}
 
-	var confirm bool
-	confirmForm := huh.NewForm(
-		huh.NewGroup(
-			huh.NewConfirm().
-				Title("Confirm use of path: '" + absoluteRepoPath + "'").
-				Description("Do you want to use this folder to store the pages ?").
-				Value(&confirm),
-		),
-	)
-	if err := confirmForm.Run(); err != nil {
-		log.Fatal(err)
-	}
-	if !confirm {
-		log.Fatalln("❌ init aborted")
+	if !*yes {
+		if !canAsk {
+			log.Fatalln("❌ standard input is not a terminal: use --yes to confirm use of path", absoluteRepoPath)
+		}
+		var confirm bool
+		confirmForm := huh.NewForm(
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title("Confirm use of path: '" + absoluteRepoPath + "'").
+					Description("Do you want to use this folder to store the pages ?").
+					Value(&confirm),
+			),
+		)
+		if err := confirmForm.Run(); err != nil {
+			log.Fatal(err)
+		}
+		if !confirm {
+			log.Fatalln("❌ init aborted")
+		}
 	}
 
-	var baseURL string
-	if len(args) < 1 {
+	baseURL := *url
+	if baseURL == "" && flags.NArg() > 0 {
+		baseURL = flags.Arg(0)
+	}
+	if baseURL == "" {
+		if !canAsk {
+			log.Fatalln("❌ standard input is not a terminal: use --url to set the URL where W is installed")
+		}
 		baseURLForm := huh.NewForm(
 			huh.NewGroup(
 				huh.NewInput().
@@ -58,12 +111,10 @@ func Init(args []string) {
 		if err := baseURLForm.Run(); err != nil {
 			log.Fatal(err)
 		}
-	} else {
-		baseURL = args[0]
 	}
 	client := api.NewClient(baseURL)
 
-	v, err := client.Version()
+	v, err := client.VersionContext(ctx)
 
 	var helper string
 	if err != nil {
@@ -87,32 +138,46 @@ func Init(args []string) {
 
 	log.Println("🔌 connected to W")
 
-	var username string
-	var password string
-
-	credentialForm := huh.NewForm(
-		huh.NewGroup(
-			huh.NewInput().
-				Title("Username").
-				Value(&username),
-			huh.NewInput().
-				EchoMode(huh.EchoMode(textinput.EchoPassword)).
-				Title("Password").
-				Value(&password),
-		),
-	)
-
-	if err := credentialForm.Run(); err != nil {
-		log.Fatal(err)
+	// token is directly saved in chosen store, so that it is never written in clear text otherwise
+	if err := database.switchTokenStore(*credentials); err != nil {
+		log.Fatalln("❌", err)
+	}
+	if envToken {
+		SaveDatabase(database)
+		fmt.Printf("🔑 authentication token will be read from %s environment variable\n", TokenEnv)
+		fmt.Println("⭐️ repository initalized")
+		return
 	}
 
-	token, err := client.Auth(username, password)
-	if err != nil {
-		log.Fatal(err)
+	var token string
+	switch {
+	case *tokenFile != "":
+		content, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatalln("❌ read token file:", err)
+		}
+		token = strings.TrimSpace(string(content))
+		if token == "" {
+			log.Fatalln("❌ token file is empty")
+		}
+	case *passwordStdin:
+		password, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalln("❌ read password:", err)
+		}
+		token, err = client.AuthContext(ctx, *username, strings.TrimRight(string(password), "\r\n"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		token, err = login(ctx, client, *username)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
+	SaveToken(database, token)
 	SaveDatabase(database)
-	SaveToken(token)
 
 	log.Println("🔓️ logged in")
 	fmt.Println("⭐️ repository initalized")
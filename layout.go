@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+// A page can be stored in several local files:
+// version 1 pages as a directory with one file per element (PAGE_ID/main.md, PAGE_ID/header.md...),
+// CSS and JavaScript as sidecar files (PAGE_ID.css, PAGE_ID.js).
+// Internally, those files are joined in a single text, each preceded by a header line and followed by a separator newline,
+// so that hashing, diffing and merging work as for pages stored in a single file.
+
+const partHeader = "==> %s <=="
+
+// elements of version 1 pages, main being the primary content
+var v1Elements = []string{"main", "header", "nav", "aside", "footer"}
+
+// how a page is stored locally
+type layout struct {
+	directory bool // version 1 page stored as a directory, with one file per element
+	sidecars  bool // CSS and JavaScript stored in sidecar files
+}
+
+// a local file of a page
+type part struct {
+	name    string // page field stored in this file, main being the primary content
+	file    string // path relative to repository
+	sidecar bool   // file stored next to the page, only written if not empty
+}
+
+// check if page is stored in several files
+func (l layout) joined() bool {
+	return l.directory || l.sidecars
+}
+
+// local files of a page, in joining order
+func (l layout) parts(id string) []part {
+	var parts []part
+	if l.directory {
+		for _, name := range v1Elements {
+			parts = append(parts, part{name: name, file: filepath.Join(id, name+".md")})
+		}
+	} else {
+		parts = append(parts, part{name: "main", file: id + ".md"})
+	}
+	if l.sidecars {
+		parts = append(parts,
+			part{name: "css", file: id + ".css", sidecar: true},
+			part{name: "javascript", file: id + ".js", sidecar: true},
+		)
+	}
+	return parts
+}
+
+// layout of a page: the recorded one if tracked, otherwise according to config
+func (db *Database) pageLayout(page *api.Page) layout {
+	if pageData, exist := db.page(page.ID); exist {
+		return pageData.layout()
+	}
+	return layout{
+		directory: page.Version == 1 && db.Config.V1Directory,
+		sidecars:  db.Config.Sidecars,
+	}
+}
+
+// layout of a tracked page
+func (db *Database) layout(id string) layout {
+	pageData, exist := db.page(id)
+	if !exist {
+		return layout{}
+	}
+	return pageData.layout()
+}
+
+func (pageData *PageData) layout() layout {
+	return layout{pageData.Directory, pageData.Sidecars}
+}
+
+// content of a page field stored in a part
+func partContent(page *api.Page, name string) string {
+	switch name {
+	case "header":
+		return page.Header
+	case "nav":
+		return page.Nav
+	case "aside":
+		return page.Aside
+	case "footer":
+		return page.Footer
+	case "css":
+		return page.CSS
+	case "javascript":
+		return page.Javascript
+	default:
+		return ""
+	}
+}
+
+// Set page fields stored in parts other than main.
+// Empty ones are cleared on the server.
+func applyParts(page *api.Page, l layout, contents map[string]string) {
+	for _, p := range l.parts(page.ID) {
+		content := contents[p.name]
+		switch p.name {
+		case "header":
+			page.Header = content
+		case "nav":
+			page.Nav = content
+		case "aside":
+			page.Aside = content
+		case "footer":
+			page.Footer = content
+		case "css":
+			page.CSS = content
+		case "javascript":
+			page.Javascript = content
+		default:
+			continue
+		}
+		if content == "" {
+			sendEmpty(page, p.name, `""`)
+		}
+	}
+}
+
+// Join part contents in a single text.
+// A separator newline is added after each part, so that headers always start a line.
+func joinParts(parts []part, contents map[string]string) string {
+	var sb strings.Builder
+	for _, p := range parts {
+		fmt.Fprintf(&sb, partHeader+"\n", p.name)
+		sb.WriteString(contents[p.name])
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Separate a text produced by joinParts into part contents.
+// Separator newlines are removed, so that contents are exactly the joined ones.
+func splitParts(parts []part, content string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, p := range parts {
+		headers[fmt.Sprintf(partHeader, p.name)] = p.name
+	}
+
+	contents := make(map[string]string)
+	var current string
+	for _, line := range splitLines(content) {
+		if name, isHeader := headers[strings.TrimRight(line, "\r\n")]; isHeader {
+			current = name
+			contents[current] = ""
+			continue
+		}
+		if current == "" {
+			return nil, fmt.Errorf("content before first %q header", fmt.Sprintf(partHeader, parts[0].name))
+		}
+		contents[current] += line
+	}
+	for name, content := range contents {
+		contents[name] = strings.TrimSuffix(content, "\n")
+	}
+	return contents, nil
+}
+
+// path of the local file of a tracked page, or of its directory
+func (db *Database) pagePath(id string) string {
+	return localPath(id, db.layout(id))
+}
+
+// path of local files of a tracked page containing conflict markers
+func (db *Database) conflictedPaths(id string) []string {
+	l := db.layout(id)
+	content, err := readLocal(id, l)
+	if !l.joined() || err != nil {
+		return []string{localPath(id, l)}
+	}
+	parts := l.parts(id)
+	contents, err := splitParts(parts, content)
+	if err != nil {
+		return []string{localPath(id, l)}
+	}
+	var paths []string
+	for _, p := range parts {
+		if hasConflictMarkers(contents[p.name]) {
+			paths = append(paths, filepath.Join(repoPath, p.file))
+		}
+	}
+	return paths
+}
+
+// path of the local file of a page, or of its directory
+func localPath(id string, l layout) string {
+	if l.directory {
+		return GetPageDir(id)
+	}
+	return GetPagePath(id)
+}
+
+// Read local content of a page.
+// Missing parts are considered empty.
+func readLocal(id string, l layout) (string, error) {
+	if !l.joined() {
+		content, err := os.ReadFile(GetPagePath(id))
+		return string(content), err
+	}
+
+	if _, err := os.Stat(localPath(id, l)); err != nil {
+		return "", err
+	}
+	parts := l.parts(id)
+	contents := make(map[string]string)
+	for _, p := range parts {
+		content, err := os.ReadFile(filepath.Join(repoPath, p.file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		contents[p.name] = string(content)
+	}
+	return joinParts(parts, contents), nil
+}
+
+// Write local content of a page, creating its directory if needed.
+// Sidecar files that would be empty are deleted.
+func writeLocal(id string, l layout, content string) error {
+	if !l.joined() {
+		return os.WriteFile(GetPagePath(id), []byte(content), 0664)
+	}
+
+	parts := l.parts(id)
+	contents, err := splitParts(parts, content)
+	if err != nil {
+		return err
+	}
+	if l.directory {
+		if err := os.MkdirAll(GetPageDir(id), 0775); err != nil {
+			return err
+		}
+	}
+	for _, p := range parts {
+		filename := filepath.Join(repoPath, p.file)
+		if p.sidecar && contents[p.name] == "" {
+			if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(filename, []byte(contents[p.name]), 0664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Last modification time of local content of a page.
+// This is the latest among its files, and its directory, as deleting a file only changes its folder.
+// As a missing sidecar file may have just been deleted, the repository folder is then taken into account too.
+func localModTime(id string, l layout) (time.Time, error) {
+	stat, err := os.Stat(localPath(id, l))
+	if err != nil {
+		return time.Time{}, err
+	}
+	modTime := stat.ModTime()
+	if !l.joined() {
+		return modTime, nil
+	}
+	for _, p := range l.parts(id) {
+		stat, err := os.Stat(filepath.Join(repoPath, p.file))
+		if p.sidecar && errors.Is(err, fs.ErrNotExist) {
+			stat, err = os.Stat(repoPath)
+		}
+		if err == nil && stat.ModTime().After(modTime) {
+			modTime = stat.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// Delete local files of a page.
+// Directories are only deleted if they do not contain any other file.
+func removeLocal(id string, l layout) error {
+	if !l.joined() {
+		return os.Remove(GetPagePath(id))
+	}
+	for _, p := range l.parts(id) {
+		err := os.Remove(filepath.Join(repoPath, p.file))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if l.directory {
+		// kept if user stored other files in it
+		if entries, err := os.ReadDir(GetPageDir(id)); err == nil && len(entries) > 0 {
+			return nil
+		}
+		return os.Remove(GetPageDir(id))
+	}
+	return nil
+}
+
+// rename local files of a page
+func renameLocal(oldID string, newID string, l layout) error {
+	if err := os.Rename(localPath(oldID, l), localPath(newID, l)); err != nil {
+		return err
+	}
+	newParts := l.parts(newID)
+	for i, p := range l.parts(oldID) {
+		if !p.sidecar {
+			continue // moved with the page file or directory
+		}
+		err := os.Rename(filepath.Join(repoPath, p.file), filepath.Join(repoPath, newParts[i].file))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
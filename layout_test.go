@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJoinSplitParts(t *testing.T) {
+	tests := []struct {
+		name     string
+		l        layout
+		contents map[string]string
+	}{
+		{"empty parts", layout{directory: true}, map[string]string{}},
+		{"trailing newlines", layout{directory: true}, map[string]string{
+			"main":   "# Title\n\ntext\n",
+			"header": "header\n",
+			"footer": "footer\n\n",
+		}},
+		{"without trailing newlines", layout{directory: true}, map[string]string{
+			"main":  "# Title\n\ntext",
+			"nav":   "nav",
+			"aside": "\n",
+		}},
+		{"windows line endings", layout{directory: true}, map[string]string{
+			"main":   "line\r\nline\r\n",
+			"header": "line\r\nline",
+		}},
+		{"sidecars", layout{sidecars: true}, map[string]string{
+			"main":       "text\n",
+			"css":        "body { color: red; }",
+			"javascript": "console.log(1);\n",
+		}},
+		{"directory and sidecars", layout{directory: true, sidecars: true}, map[string]string{
+			"main":       "text",
+			"footer":     "footer\n",
+			"css":        "\n\n",
+			"javascript": "alert(1)",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts := test.l.parts("page")
+			joined := joinParts(parts, test.contents)
+			contents, err := splitParts(parts, joined)
+			if err != nil {
+				t.Fatalf("split %q: %v", joined, err)
+			}
+			for _, p := range parts {
+				if contents[p.name] != test.contents[p.name] {
+					t.Errorf("part %s: got %q, want %q", p.name, contents[p.name], test.contents[p.name])
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveLocalKeepsOtherFiles(t *testing.T) {
+	repoPath = t.TempDir()
+	l := layout{directory: true}
+	if err := writeLocal("page", l, joinParts(l.parts("page"), map[string]string{"main": "text"})); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(GetPageDir("page"), "notes.txt")
+	if err := os.WriteFile(other, []byte("notes"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeLocal("page", l); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("other file was not kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(GetPageDir("page"), "main.md")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("page file was not deleted: %v", err)
+	}
+
+	os.Remove(other)
+	if err := removeLocal("page", l); err != nil {
+		t.Fatalf("remove again: %v", err)
+	}
+	if _, err := os.Stat(GetPageDir("page")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("empty directory was not deleted: %v", err)
+	}
+}
@@ -1,25 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"maps"
 	"slices"
 
 	"github.com/charmbracelet/huh"
-	"github.com/vincent-peugnet/wsync/api"
 )
 
-func List() {
+func List(ctx context.Context) {
 	database := LoadDatabase()
-	token := LoadToken()
+	client := newClient(database)
 
-	client := api.NewClient(database.Config.BaseURL)
-	client.Token = token
-
-	ids, err := client.List()
+	ids, err := client.ListContext(ctx)
 	if err != nil {
-		log.Fatalln(err)
+		fatalRequest(ctx, database, client, err)
 	}
 
 	var options []huh.Option[string]
@@ -60,11 +57,11 @@ func List() {
 		}
 		if confirmAdd {
 			for _, id := range addedIds {
-				err := database.addPage(client, id)
+				err := database.addPage(ctx, client, id)
 				if err != nil {
 					fmt.Printf("❌ error while adding page %q: %v\n", id, err)
 				} else {
-					fmt.Printf("⭐️ added new tracked page %q, created new file %q\n", id, GetPagePath(id))
+					fmt.Printf("⭐️ added new tracked page %q, created new file %q\n", id, database.pagePath(id))
 				}
 			}
 		}
@@ -85,13 +82,12 @@ func List() {
 		}
 		if confirmRemove {
 			for _, id := range removedIds {
+				path := database.pagePath(id)
 				fileDeleted, err := database.removePage(id)
 				if err != nil {
 					fmt.Printf("❌ error while removing %q: %v\n", id, err)
-				} else if fileDeleted {
-					fmt.Printf("🗑️  removed page %q and deleted local associated file\n", id)
 				} else {
-					fmt.Printf("🛡️  untracked page %q, but kept %q file because of local modifications\n", id, GetPagePath(id))
+					printRemoved(id, path, fileDeleted)
 				}
 			}
 		}
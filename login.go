@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+func Login(ctx context.Context) {
+	database := LoadDatabase()
+	if database.tokenReadOnly() {
+		log.Fatalf("❌ %v, set it to a valid token instead of logging in", errReadOnlyStore)
+	}
+	client := newAnonymousClient(database)
+
+	token, err := login(ctx, client, "")
+	if err != nil {
+		log.Fatalln("❌ could not log in:", err)
+	}
+	SaveToken(database, token)
+
+	fmt.Println("🔓️ logged in")
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+)
+
+// W has no endpoint to revoke a token, so it is only deleted locally
+func Logout() {
+	database := LoadDatabase()
+
+	deleted := DeleteToken(database)
+	if !deleted {
+		fmt.Println("✅ already logged out")
+		return
+	}
+	fmt.Println("🔒 logged out, authentication token deleted")
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 
 	"github.com/charmbracelet/huh"
 )
@@ -11,17 +14,22 @@ import (
 var repoPath string  // local repo path
 var force bool       // force pull and push operations
 var interactive bool // interactive mode
+var jobs int         // number of pages processed concurrently
 
 const (
-	DatabasePath   = ".wsync/database.json"
-	TokenPath      = ".wsync/token"
-	WacceptedMajor = 3
-	WminMinor      = 12
+	DatabasePath       = ".wsync/database.json"
+	TokenPath          = ".wsync/token"
+	EncryptedTokenPath = ".wsync/token.enc"
+	BasePath           = ".wsync/base"
+	RemotePath         = ".wsync/remote"
+	DefaultMediaDir    = "media"
+	WacceptedMajor     = 3
+	WminMinor          = 12
 )
 
 // ___________________________ INTERFACE ___________________________
 
-func menu() {
+func menu(ctx context.Context) {
 	interactive = true
 
 	var action string
@@ -31,11 +39,13 @@ func menu() {
 				Title("What to do ?").
 				Options(
 					huh.NewOption("Status", "status"),
+					huh.NewOption("Fetch", "fetch"),
 					huh.NewOption("Sync", "sync"),
 					huh.NewOption("Push", "push"),
 					huh.NewOption("Pull", "pull"),
 					huh.NewOption("List", "list"),
 					huh.NewOption("Init", "init"),
+					huh.NewOption("Login", "login"),
 					huh.NewOption("nothing", "nothing"),
 				).
 				Value(&action),
@@ -48,56 +58,92 @@ func menu() {
 
 	switch action {
 	case "init":
-		Init(nil)
+		Init(ctx, nil)
+	case "login":
+		Login(ctx)
 	case "status":
-		Status()
+		Status(nil)
 	case "list":
-		List()
+		List(ctx)
+	case "fetch":
+		Fetch(ctx, nil)
 	case "sync":
-		Sync(nil)
+		Sync(ctx, nil)
 	case "push":
-		Push(nil)
+		Push(ctx, nil)
 	case "pull":
-		Pull(nil)
+		Pull(ctx, nil)
 	default:
 		fmt.Println("bye bye 👋")
 	}
 }
 
+// Context canceled on first interrupt signal, so that in-flight requests are stopped
+// and commands can save what was already processed. A second signal exits immediately.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
 func main() {
 	log.SetFlags(0)
 
 	flag.StringVar(&repoPath, "C", ".", "set the working directory")
 	flag.BoolVar(&force, "F", false, "force push or pull")
 	flag.BoolVar(&interactive, "i", false, "enable interactive mode")
+	flag.IntVar(&jobs, "j", 1, "number of pages processed concurrently")
 	flag.Parse()
 
+	ctx := interruptContext()
+
 	args := flag.Args()
 	if len(args) >= 1 {
 		switch args[0] {
 		case "init":
-			Init(args[1:])
+			Init(ctx, args[1:])
 		case "sync":
-			Sync(args[1:])
+			Sync(ctx, args[1:])
 		case "pull":
-			Pull(args[1:])
+			Pull(ctx, args[1:])
 		case "push":
-			Push(args[1:])
+			Push(ctx, args[1:])
 		case "remove":
-			Remove(args[1:])
+			Remove(ctx, args[1:])
 		case "add":
-			Add(args[1:])
+			Add(ctx, args[1:])
+		case "new":
+			New(ctx, args[1:])
+		case "mv":
+			Move(ctx, args[1:])
+		case "resolve":
+			Resolve(args[1:])
+		case "diff":
+			Diff(ctx, args[1:])
+		case "fetch":
+			Fetch(ctx, args[1:])
 		case "list":
-			List()
+			List(ctx)
 		case "status":
-			Status()
+			Status(args[1:])
+		case "media":
+			Media(ctx, args[1:])
+		case "login":
+			Login(ctx)
+		case "logout":
+			Logout()
+		case "config":
+			Config(args[1:])
 		case "version":
 			Version()
 		default:
 			log.Fatalln("invalid sub command")
 		}
 	} else {
-		menu()
+		menu(ctx)
 	}
 
 }
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+type MediaData struct {
+	Size      int64     // size on the server at last sync
+	DateModif time.Time // server modification date at last sync
+	DateSync  time.Time // taken before reading local file, so that edits made during upload are detected
+	Hash      string    // hash of last synced content
+}
+
+// media file existing on the server but never downloaded
+const StateRemoteOnly PageState = "remote-only"
+
+type mediaStatus struct {
+	Path   string
+	State  PageState
+	remote *api.Media
+}
+
+// human readable labels of each media state, in display order
+var mediaStateLabels = []struct {
+	state PageState
+	emoji string
+	label string
+}{
+	{StateModified, "✏️ ", "localy edited file(s), to upload"},
+	{StateUntracked, "❔", "new local file(s), to upload"},
+	{StateBehind, "⬇️ ", "file(s) edited on server, to download"},
+	{StateRemoteOnly, "🆕", "new file(s) on server, to download"},
+	{StateDiverged, "🔀", "file(s) edited on both sides, diverged"},
+	{StateDeletedLocally, "🕳️ ", "file(s) deleted locally"},
+	{StateDeletedRemotely, "🗑️ ", "file(s) deleted on server"},
+}
+
+type mediaAction int
+
+const (
+	mediaNone mediaAction = iota
+	mediaDownloaded
+	mediaUploaded
+	mediaAdopted // identical on both sides, only tracked
+	mediaRemoved
+	mediaKept    // deleted on server, but kept because of local modifications
+	mediaSkipped // deleted locally, but media can not be deleted on server
+)
+
+func Media(ctx context.Context, args []string) {
+	subcommand := "status"
+	if len(args) > 0 {
+		subcommand = args[0]
+		args = args[1:]
+	}
+
+	database := LoadDatabase()
+	client := newClient(database)
+
+	switch subcommand {
+	case "list":
+		mediaList(ctx, database, client)
+	case "status":
+		flags := flag.NewFlagSet("media status", flag.ExitOnError)
+		porcelain := flags.Bool("porcelain", false, "print one 'STATE PATH' line per file")
+		flags.Parse(args)
+		mediaStatusCommand(ctx, database, client, *porcelain)
+	case "pull":
+		mediaTransfer(ctx, database, client, "pull", args, database.pullMedia)
+	case "push":
+		mediaTransfer(ctx, database, client, "push", args, database.pushMedia)
+	default:
+		log.Fatalf("unknown media sub-command %q, expected list, status, pull or push", subcommand)
+	}
+}
+
+func mediaList(ctx context.Context, database *Database, client *api.Client) {
+	list, err := client.MediaListContext(ctx)
+	if err != nil {
+		fatalRequest(ctx, database, client, "list media:", err)
+	}
+	slices.SortFunc(list, func(a, b *api.Media) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	for _, media := range list {
+		fmt.Printf("%s\t%d\t%s\n", media.Path, media.Size, media.DateModif.Local().Format(time.DateTime))
+	}
+}
+
+func mediaStatusCommand(ctx context.Context, database *Database, client *api.Client, porcelain bool) {
+	statuses, err := database.mediaStatuses(ctx, client)
+	if err != nil {
+		fatalRequest(ctx, database, client, "error:", err)
+	}
+
+	if porcelain {
+		for _, status := range statuses {
+			fmt.Println(status.State, status.Path)
+		}
+		return
+	}
+
+	byState := make(map[PageState][]string)
+	var tracked int
+	for _, status := range statuses {
+		byState[status.State] = append(byState[status.State], status.Path)
+		if status.State != StateUntracked && status.State != StateRemoteOnly {
+			tracked++
+		}
+	}
+	fmt.Printf("🖼️  media folder %q contains %d tracked file(s)\n", database.mediaDir(), tracked)
+	fmt.Println("  ↳ including", len(byState[StateUpToDate]), "up to date file(s)")
+	for _, stateLabel := range mediaStateLabels {
+		paths := byState[stateLabel.state]
+		if len(paths) > 0 {
+			fmt.Println(stateLabel.emoji, len(paths), stateLabel.label, paths)
+		}
+	}
+}
+
+// pull or push media files matching given paths, or all media files
+func mediaTransfer(ctx context.Context, database *Database, client *api.Client, verb string, args []string, transfer func(context.Context, *api.Client, mediaStatus, bool) (mediaAction, error)) {
+	statuses, err := database.mediaStatuses(ctx, client)
+	if err != nil {
+		fatalRequest(ctx, database, client, "error:", err)
+	}
+
+	byPath := make(map[string]mediaStatus)
+	var paths []string
+	for _, status := range statuses {
+		if matchMediaPath(status.Path, args) {
+			byPath[status.Path] = status
+			paths = append(paths, status.Path)
+		}
+	}
+
+	type transferResult struct {
+		action mediaAction
+		err    error
+	}
+
+	var i int
+	var rejected bool // authentication token rejected by server
+	processPages(ctx, paths, func(path string) transferResult {
+		action, err := transfer(ctx, client, byPath[path], force)
+		return transferResult{action, err}
+	}, func(path string, result transferResult) {
+		switch {
+		case errors.Is(result.err, api.ErrUnauthorized):
+			rejected = true
+		case errors.Is(result.err, api.ErrForbidden):
+			fmt.Printf("🚫 not allowed to %s media %q\n", verb, path)
+		case result.err != nil:
+			fmt.Printf("❌ could not %s media %q: %v\n", verb, path, result.err)
+		case result.action == mediaDownloaded:
+			fmt.Printf("⬇️  downloaded media %q\n", path)
+		case result.action == mediaUploaded:
+			fmt.Printf("⬆️  uploaded media %q\n", path)
+		case result.action == mediaAdopted:
+			fmt.Printf("🔗 media %q is identical on both sides, it is now tracked\n", path)
+		case result.action == mediaRemoved:
+			fmt.Printf("🗑️  media %q was deleted on server, removed local file\n", path)
+		case result.action == mediaKept:
+			fmt.Printf("🛡️  media %q was deleted on server, but kept local file because of local modifications\n", path)
+		case result.action == mediaSkipped:
+			fmt.Printf("🕳️  media %q was deleted locally, skipped as it can not be deleted on server, run 'wsync media pull' to restore it\n", path)
+		default:
+			return
+		}
+		i++
+	})
+	if rejected {
+		unauthorized(ctx, database, client)
+	} else if i == 0 && ctx.Err() == nil {
+		fmt.Println("✅ media folder is already up to date")
+	}
+
+	SaveDatabase(database)
+}
+
+// check if media path is one of the given paths, or inside one of them
+func matchMediaPath(path string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		filter = strings.Trim(filepath.ToSlash(filter), "/")
+		if path == filter || strings.HasPrefix(path, filter+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// return a copy of the data of a tracked media file
+func (db *Database) media(path string) (*MediaData, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	mediaData, exist := db.Media[path]
+	if !exist {
+		return nil, false
+	}
+	mediaDataCopy := *mediaData
+	return &mediaDataCopy, true
+}
+
+// track media file or update its data
+func (db *Database) setMedia(path string, mediaData *MediaData) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.Media == nil {
+		db.Media = make(map[string]*MediaData)
+	}
+	db.Media[path] = mediaData
+}
+
+func (db *Database) untrackMedia(path string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.Media, path)
+}
+
+// local folder where media files are stored, relative to repository
+func (db *Database) mediaDir() string {
+	if db.Config.MediaDir == "" {
+		return DefaultMediaDir
+	}
+	return db.Config.MediaDir
+}
+
+// local path of a media file
+func (db *Database) mediaPath(path string) string {
+	return filepath.Join(repoPath, db.mediaDir(), filepath.FromSlash(path))
+}
+
+// list local media files, ignoring hidden ones
+func (db *Database) localMedia() ([]string, error) {
+	root := filepath.Join(repoPath, db.mediaDir())
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == root {
+			return fs.SkipAll // no media folder yet
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != root {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			relative, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(relative))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list local media: %w", err)
+	}
+	return paths, nil
+}
+
+// checks if tracked media file has been modified locally
+func (db *Database) mediaModified(path string) (bool, error) {
+	mediaData, exist := db.media(path)
+	if !exist {
+		return false, fmt.Errorf("not found in tracked media")
+	}
+	stat, err := os.Stat(db.mediaPath(path))
+	if err != nil {
+		return false, fmt.Errorf("file not found: %w", err)
+	}
+	if !stat.ModTime().After(mediaData.DateSync) {
+		return false, nil // file was not touched since last sync
+	}
+	hash, err := hashFile(db.mediaPath(path))
+	if err != nil {
+		return false, err
+	}
+	return hash != mediaData.Hash, nil
+}
+
+// classify tracked, local and remote media files
+func (db *Database) mediaStatuses(ctx context.Context, co *api.Client) ([]mediaStatus, error) {
+	remoteList, err := co.MediaListContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list media: %w", err)
+	}
+	remotes := make(map[string]*api.Media)
+	for _, media := range remoteList {
+		remotes[media.Path] = media
+	}
+	localList, err := db.localMedia()
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	paths := slices.Collect(maps.Keys(db.Media))
+	db.mu.Unlock()
+	paths = append(paths, localList...)
+	paths = append(paths, slices.Collect(maps.Keys(remotes))...)
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	var statuses []mediaStatus
+	for _, path := range paths {
+		mediaData, tracked := db.media(path)
+		remote := remotes[path]
+		local := slices.Contains(localList, path)
+
+		var state PageState
+		switch {
+		case !tracked && !local:
+			state = StateRemoteOnly
+		case !tracked && remote == nil:
+			state = StateUntracked
+		case !tracked:
+			state = StateDiverged // exist on both sides without being tracked
+		case remote == nil:
+			state = StateDeletedRemotely
+		case !local:
+			state = StateDeletedLocally
+		default:
+			modified, err := db.mediaModified(path)
+			if err != nil {
+				return nil, err
+			}
+			remotelyModified := remote.Size != mediaData.Size || !remote.DateModif.Equal(mediaData.DateModif)
+			switch {
+			case modified && remotelyModified:
+				state = StateDiverged
+			case modified:
+				state = StateModified
+			case remotelyModified:
+				state = StateBehind
+			default:
+				state = StateUpToDate
+			}
+		}
+		statuses = append(statuses, mediaStatus{Path: path, State: state, remote: remote})
+	}
+	return statuses, nil
+}
+
+// Download media files that are new or modified on the server, and restore those deleted locally.
+// Local files of media deleted on the server are removed, unless modified.
+func (db *Database) pullMedia(ctx context.Context, co *api.Client, status mediaStatus, force bool) (mediaAction, error) {
+	_, tracked := db.media(status.Path)
+
+	switch status.State {
+	case StateRemoteOnly, StateBehind, StateDeletedLocally:
+		return mediaDownloaded, db.downloadMedia(ctx, co, status.remote)
+	case StateDiverged:
+		if !tracked {
+			adopted, err := db.adoptMedia(ctx, co, status.remote)
+			if err != nil || adopted {
+				return mediaAdopted, err
+			}
+		}
+		if !force {
+			return mediaNone, fmt.Errorf("local file differs from server version, use -F to overwrite it")
+		}
+		return mediaDownloaded, db.downloadMedia(ctx, co, status.remote)
+	case StateDeletedRemotely:
+		modified, err := db.mediaModified(status.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			db.untrackMedia(status.Path)
+			return mediaRemoved, nil
+		}
+		if err != nil {
+			return mediaNone, err
+		}
+		db.untrackMedia(status.Path)
+		if modified && !force {
+			return mediaKept, nil
+		}
+		if err := os.Remove(db.mediaPath(status.Path)); err != nil {
+			return mediaNone, fmt.Errorf("delete file: %w", err)
+		}
+		return mediaRemoved, nil
+	default:
+		return mediaNone, nil
+	}
+}
+
+// Upload media files that are new or modified locally.
+// Files modified or deleted on the server since last sync are only uploaded if force is true.
+func (db *Database) pushMedia(ctx context.Context, co *api.Client, status mediaStatus, force bool) (mediaAction, error) {
+	_, tracked := db.media(status.Path)
+
+	switch status.State {
+	case StateUntracked, StateModified:
+		return mediaUploaded, db.uploadMedia(ctx, co, status.Path)
+	case StateDiverged:
+		if !tracked {
+			adopted, err := db.adoptMedia(ctx, co, status.remote)
+			if err != nil || adopted {
+				return mediaAdopted, err
+			}
+		}
+		if !force {
+			return mediaNone, fmt.Errorf("%w: server version differs from local file, use -F to overwrite it", api.ErrConflict)
+		}
+		return mediaUploaded, db.uploadMedia(ctx, co, status.Path)
+	case StateDeletedRemotely:
+		if !force {
+			return mediaNone, fmt.Errorf("deleted on server, use -F to upload it again or pull to remove local file")
+		}
+		return mediaUploaded, db.uploadMedia(ctx, co, status.Path)
+	case StateDeletedLocally:
+		return mediaSkipped, nil
+	default:
+		return mediaNone, nil
+	}
+}
+
+// download media file next to its destination, then replace it
+func (db *Database) downloadMedia(ctx context.Context, co *api.Client, media *api.Media) error {
+	if !filepath.IsLocal(filepath.FromSlash(media.Path)) {
+		return fmt.Errorf("invalid media path %q", media.Path)
+	}
+	content, err := co.DownloadContext(ctx, media.Path)
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	defer content.Close()
+
+	filename := db.mediaPath(media.Path)
+	if err := os.MkdirAll(filepath.Dir(filename), 0775); err != nil {
+		return fmt.Errorf("create folder: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(filename), ".wsync-*")
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), content); err != nil {
+		file.Close()
+		return fmt.Errorf("download: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	db.setMedia(media.Path, &MediaData{
+		Size:      media.Size,
+		DateModif: media.DateModif,
+		DateSync:  time.Now(),
+		Hash:      hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+func (db *Database) uploadMedia(ctx context.Context, co *api.Client, path string) error {
+	syncedAt := time.Now()
+	file, err := os.Open(db.mediaPath(path))
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+	defer file.Close()
+
+	// hashed while uploaded, so that hash matches uploaded content
+	hash := sha256.New()
+	media, err := co.UploadContext(ctx, path, io.TeeReader(file, hash))
+	if err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+
+	db.setMedia(path, &MediaData{
+		Size:      media.Size,
+		DateModif: media.DateModif,
+		DateSync:  syncedAt,
+		Hash:      hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// Start tracking an untracked local file existing on the server, if both are identical.
+// Return false if they differ.
+func (db *Database) adoptMedia(ctx context.Context, co *api.Client, media *api.Media) (bool, error) {
+	localHash, err := hashFile(db.mediaPath(media.Path))
+	if err != nil {
+		return false, err
+	}
+	content, err := co.DownloadContext(ctx, media.Path)
+	if err != nil {
+		return false, fmt.Errorf("download: %w", err)
+	}
+	defer content.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return false, fmt.Errorf("download: %w", err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != localHash {
+		return false, nil
+	}
+
+	db.setMedia(media.Path, &MediaData{
+		Size:      media.Size,
+		DateModif: media.DateModif,
+		DateSync:  time.Now(),
+		Hash:      localHash,
+	})
+	return true, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	markerLocal  = "<<<<<<< local"
+	markerSep    = "======="
+	markerServer = ">>>>>>> server"
+)
+
+type diffOp int
+
+const (
+	opEqual diffOp = iota
+	opDelete
+	opInsert
+)
+
+// a single line operation, A and B are line indexes in the two compared texts
+type edit struct {
+	Op diffOp
+	A  int
+	B  int
+}
+
+// split text into lines, keeping line endings
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Compute the shortest edit script between a and b using the linear space variant of Myers algorithm.
+// Texts are split around the middle snake of an optimal path until one of their ranges is empty,
+// so that memory stays proportional to the number of lines.
+func diffLines(a, b []string) []edit {
+	var edits []edit
+	diffRange(a, b, 0, len(a), 0, len(b), &edits)
+	return edits
+}
+
+// append to edits the shortest edit script between a[aLo:aHi] and b[bLo:bHi]
+func diffRange(a, b []string, aLo, aHi, bLo, bHi int, edits *[]edit) {
+	// common prefix
+	for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+		*edits = append(*edits, edit{Op: opEqual, A: aLo, B: bLo})
+		aLo++
+		bLo++
+	}
+	// common suffix, appended once the middle is done
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && a[aHi-suffix-1] == b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for y := bLo; y < bHi; y++ {
+			*edits = append(*edits, edit{Op: opInsert, A: aLo, B: y})
+		}
+	case bLo == bHi:
+		for x := aLo; x < aHi; x++ {
+			*edits = append(*edits, edit{Op: opDelete, A: x, B: bLo})
+		}
+	default:
+		// as first and last lines differ, both halves are smaller than the whole range
+		x, y, u, v := middleSnake(a[aLo:aHi], b[bLo:bHi])
+		diffRange(a, b, aLo, aLo+x, bLo, bLo+y, edits)
+		for i := range u - x {
+			*edits = append(*edits, edit{Op: opEqual, A: aLo + x + i, B: bLo + y + i})
+		}
+		diffRange(a, b, aLo+u, aHi, bLo+v, bHi, edits)
+	}
+
+	for i := range suffix {
+		*edits = append(*edits, edit{Op: opEqual, A: aHi + i, B: bHi + i})
+	}
+}
+
+// Find the snake in the middle of an optimal path from the start to the end of a and b,
+// by searching from both ends at the same time.
+// Return the coordinates of its start (x, y) and end (u, v).
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// furthest x reached on each diagonal k, from the start, and from the end with reversed texts
+	forward := make([]int, 2*maxD+3)
+	backward := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			forward[offset+k] = u
+			// paths can only meet on a diagonal also reached from the end at previous step
+			if rk := delta - k; delta%2 != 0 && rk >= -(d-1) && rk <= d-1 && u+backward[offset+rk] >= n {
+				return x, y, u, v
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var rx int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				rx = backward[offset+k+1]
+			} else {
+				rx = backward[offset+k-1] + 1
+			}
+			ry := rx - k
+			ru, rv := rx, ry
+			for ru < n && rv < m && a[n-1-ru] == b[m-1-rv] {
+				ru++
+				rv++
+			}
+			backward[offset+k] = ru
+			if fk := delta - k; delta%2 == 0 && fk >= -d && fk <= d && forward[offset+fk]+ru >= n {
+				return n - ru, m - rv, n - rx, m - ry
+			}
+		}
+	}
+	return 0, 0, 0, 0 // not reached, paths always meet
+}
+
+// map each line of a to the matching line of b, -1 if the line is not kept
+func matchLines(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	for _, e := range diffLines(a, b) {
+		if e.Op == opEqual {
+			matches[e.A] = e.B
+		}
+	}
+	return matches
+}
+
+// Line based three-way merge of local and server versions using their common base.
+// Return merged text and the number of conflicting hunks.
+// Conflicting hunks are surrounded with git style markers in the merged text.
+func merge3(base, local, server string) (string, int) {
+	baseLines := splitLines(base)
+	localLines := splitLines(local)
+	serverLines := splitLines(server)
+
+	localMatches := matchLines(baseLines, localLines)
+	serverMatches := matchLines(baseLines, serverLines)
+
+	var merged strings.Builder
+	var conflicts int
+	i, j, k := 0, 0, 0
+	for {
+		// stable lines, unchanged on both sides
+		if i < len(baseLines) && localMatches[i] == j && serverMatches[i] == k {
+			merged.WriteString(baseLines[i])
+			i++
+			j++
+			k++
+			continue
+		}
+
+		// look for the next line that is kept on both sides
+		nextI, nextJ, nextK := len(baseLines), len(localLines), len(serverLines)
+		for l := i; l < len(baseLines); l++ {
+			if localMatches[l] >= j && serverMatches[l] >= k {
+				nextI, nextJ, nextK = l, localMatches[l], serverMatches[l]
+				break
+			}
+		}
+
+		baseChunk := baseLines[i:nextI]
+		localChunk := localLines[j:nextJ]
+		serverChunk := serverLines[k:nextK]
+
+		switch {
+		case equalLines(localChunk, baseChunk):
+			writeLines(&merged, serverChunk)
+		case equalLines(serverChunk, baseChunk), equalLines(localChunk, serverChunk):
+			writeLines(&merged, localChunk)
+		default:
+			conflicts++
+			writeConflict(&merged, localChunk, serverChunk)
+		}
+
+		if nextI == len(baseLines) {
+			break
+		}
+		i, j, k = nextI, nextJ, nextK
+	}
+
+	return merged.String(), conflicts
+}
+
+// check if text still contains lines added by writeConflict
+func hasConflictMarkers(text string) bool {
+	for _, line := range splitLines(text) {
+		line = strings.TrimRight(line, "\r\n")
+		if line == markerLocal || line == markerServer {
+			return true
+		}
+	}
+	return false
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+}
+
+// write conflicting hunk surrounded by markers, making sure each marker stands on its own line
+func writeConflict(sb *strings.Builder, local, server []string) {
+	writeMarked := func(lines []string, marker string) {
+		for _, line := range lines {
+			sb.WriteString(line)
+		}
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(marker + "\n")
+	}
+	sb.WriteString(markerLocal + "\n")
+	writeMarked(local, markerSep)
+	writeMarked(server, markerServer)
+}
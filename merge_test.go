@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		local     string
+		server    string
+		merged    string
+		conflicts int
+	}{
+		{
+			name:   "unchanged",
+			base:   "a\nb\nc\n",
+			local:  "a\nb\nc\n",
+			server: "a\nb\nc\n",
+			merged: "a\nb\nc\n",
+		},
+		{
+			name:   "only local change",
+			base:   "a\nb\nc\n",
+			local:  "a\nB\nc\n",
+			server: "a\nb\nc\n",
+			merged: "a\nB\nc\n",
+		},
+		{
+			name:   "only server change",
+			base:   "a\nb\nc\n",
+			local:  "a\nb\nc\n",
+			server: "a\nb\nc\nd\n",
+			merged: "a\nb\nc\nd\n",
+		},
+		{
+			name:   "clean merge of separate changes",
+			base:   "a\nb\nc\nd\ne\n",
+			local:  "A\nb\nc\nd\ne\n",
+			server: "a\nb\nc\ne\nf\n",
+			merged: "A\nb\nc\ne\nf\n",
+		},
+		{
+			name:   "same change on both sides",
+			base:   "a\nb\nc\n",
+			local:  "a\nB\nc\nd\n",
+			server: "a\nB\nc\nd\n",
+			merged: "a\nB\nc\nd\n",
+		},
+		{
+			name:      "overlapping edits",
+			base:      "a\nb\nc\n",
+			local:     "a\nlocal\nc\n",
+			server:    "a\nserver\nc\n",
+			merged:    "a\n<<<<<<< local\nlocal\n=======\nserver\n>>>>>>> server\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:      "deleted on one side, edited on the other",
+			base:      "a\nb\nc\n",
+			local:     "a\nc\n",
+			server:    "a\nB\nc\n",
+			merged:    "a\n<<<<<<< local\n=======\nB\n>>>>>>> server\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:      "two overlapping hunks",
+			base:      "a\nb\nc\nd\ne\n",
+			local:     "A\nb\nc\nd\nE\n",
+			server:    "1\nb\nc\nd\n5\n",
+			merged:    "<<<<<<< local\nA\n=======\n1\n>>>>>>> server\nb\nc\nd\n<<<<<<< local\nE\n=======\n5\n>>>>>>> server\n",
+			conflicts: 2,
+		},
+		{
+			name:      "empty base",
+			base:      "",
+			local:     "local\n",
+			server:    "server\n",
+			merged:    "<<<<<<< local\nlocal\n=======\nserver\n>>>>>>> server\n",
+			conflicts: 1,
+		},
+		{
+			name:   "empty base with identical sides",
+			base:   "",
+			local:  "same\n",
+			server: "same\n",
+			merged: "same\n",
+		},
+		{
+			name:      "markers on their own line without trailing newline",
+			base:      "a\nb",
+			local:     "a\nlocal",
+			server:    "a\nserver",
+			merged:    "a\n<<<<<<< local\nlocal\n=======\nserver\n>>>>>>> server\n",
+			conflicts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, conflicts := merge3(test.base, test.local, test.server)
+			if merged != test.merged {
+				t.Errorf("merged text: got %q, want %q", merged, test.merged)
+			}
+			if conflicts != test.conflicts {
+				t.Errorf("conflicts: got %d, want %d", conflicts, test.conflicts)
+			}
+			if got := hasConflictMarkers(merged); got != (test.conflicts > 0) {
+				t.Errorf("hasConflictMarkers: got %t with %d conflicts", got, test.conflicts)
+			}
+		})
+	}
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"", false},
+		{"plain text\n", false},
+		{"a\n<<<<<<< local\nb\n=======\nc\n>>>>>>> server\n", true},
+		{"a\r\n<<<<<<< local\r\nb\r\n", true},
+		{"only the end\n>>>>>>> server", true},
+		{"=======\nseparator alone, like a setext heading underline\n", false},
+		{"inline <<<<<<< local marker\n", false},
+		{"<<<<<<< HEAD\n", false},
+	}
+	for _, test := range tests {
+		if got := hasConflictMarkers(test.text); got != test.want {
+			t.Errorf("hasConflictMarkers(%q): got %t, want %t", test.text, got, test.want)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       string
+		b       string
+		changes int
+	}{
+		{"identical", "a\nb\nc\n", "a\nb\nc\n", 0},
+		{"empty a", "", "a\nb\n", 2},
+		{"empty b", "a\nb\n", "", 2},
+		{"replaced line", "a\nb\nc\n", "a\nB\nc\n", 2},
+		{"interleaved changes", "a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n", 5},
+		{"nothing in common", "a\nb\nc\n", "d\ne\n", 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := splitLines(test.a), splitLines(test.b)
+			var result strings.Builder
+			var changes, x, y int
+			for _, e := range diffLines(a, b) {
+				if e.A != x || e.B != y {
+					t.Fatalf("edit %+v does not start at (%d, %d)", e, x, y)
+				}
+				switch e.Op {
+				case opEqual:
+					if a[x] != b[y] {
+						t.Fatalf("lines %q and %q considered equal", a[x], b[y])
+					}
+					result.WriteString(a[x])
+					x++
+					y++
+				case opDelete:
+					changes++
+					x++
+				case opInsert:
+					changes++
+					result.WriteString(b[y])
+					y++
+				}
+			}
+			if x != len(a) || result.String() != test.b {
+				t.Errorf("edits produce %q, want %q", result.String(), test.b)
+			}
+			if changes != test.changes {
+				t.Errorf("changes: got %d, want %d", changes, test.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+func Move(ctx context.Context, args []string) {
+	if len(args) != 2 {
+		log.Fatalln("mv sub-command need exactly two page id arguments: OLD_ID NEW_ID")
+	}
+	oldID, newID := args[0], args[1]
+
+	database := LoadDatabase()
+	client := newClient(database)
+
+	err := database.movePage(ctx, client, oldID, newID, force)
+	if errors.Is(err, ErrOldPageKept) {
+		fmt.Printf("⚠️  renamed page %q to %q, but %v\n", oldID, newID, err)
+		fmt.Printf("💡 run 'wsync add %s' then 'wsync remove --remote %s' to delete it\n", oldID, oldID)
+	} else if errors.Is(err, api.ErrUnauthorized) {
+		unauthorized(ctx, database, client)
+	} else if errors.Is(err, api.ErrForbidden) {
+		fmt.Printf("🚫 not allowed to rename page %q to %q\n", oldID, newID)
+	} else if err != nil {
+		fmt.Printf("❌ could not rename page %q to %q: %v\n", oldID, newID, err)
+	} else {
+		fmt.Printf("🚚 renamed page %q to %q ", oldID, newID)
+		fmt.Print(database.Config.BaseURL + "/" + newID + "\n")
+	}
+
+	SaveDatabase(database)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/vincent-peugnet/wsync/api"
+)
+
+func New(ctx context.Context, args []string) {
+	if len(args) < 1 {
+		log.Fatalln("new sub-command need at least one page id argument")
+	}
+
+	database := LoadDatabase()
+	client := newClient(database)
+
+	for i, id := range args {
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 interrupted, %d page(s) were not processed\n", len(args)-i)
+			break
+		}
+		err := database.createPage(ctx, client, id, false)
+		if errors.Is(err, api.ErrUnauthorized) {
+			unauthorized(ctx, database, client)
+			break
+		} else if errors.Is(err, api.ErrForbidden) {
+			fmt.Printf("🚫 not allowed to create page %q\n", id)
+		} else if err != nil {
+			fmt.Printf("❌ error while creating page %q: %v\n", id, err)
+		} else {
+			fmt.Printf("🌱 created new page %q on server and new file %q ", id, database.pagePath(id))
+			fmt.Print(database.Config.BaseURL + "/" + id + "\n")
+		}
+	}
+
+	SaveDatabase(database)
+}
@@ -1,39 +1,59 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"maps"
-	"slices"
 
 	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Pull(args []string) {
+func Pull(ctx context.Context, args []string) {
 	database := LoadDatabase()
-	token := LoadToken()
+	client := newClient(database)
 
-	client := api.NewClient(database.Config.BaseURL)
-	client.Token = token
-
-	var pages []string
-	if len(args) > 0 {
-		pages = args
-	} else {
-		pages = slices.Collect(maps.Keys(database.Pages))
+	type pullResult struct {
+		pulled bool
+		err    error
 	}
+
+	pages := filterRemotelyModified(ctx, database, client, selectPages(database, args))
+	var deleted []string // pages deleted on server, prompted once all pages are processed
 	var i int
-	for _, id := range pages {
-		pulled, err := database.pullPage(client, id, force)
-		if err != nil {
-			fmt.Printf("❌ could not pull page: %q: %v\n", id, err)
+	var rejected bool // authentication token rejected by server
+	processPages(ctx, pages, func(id string) pullResult {
+		pulled, err := database.pullPage(ctx, client, id, force)
+		return pullResult{pulled, err}
+	}, func(id string, result pullResult) {
+		if interactive && errors.Is(result.err, api.ErrNotFound) {
+			deleted = append(deleted, id)
+			i++
+		} else if errors.Is(result.err, api.ErrNotFound) {
+			fmt.Printf("🗑️  page %q was deleted on server, run 'wsync remove %s' to untrack it\n", id, id)
+			i++
+		} else if errors.Is(result.err, api.ErrUnauthorized) {
+			rejected = true
+			i++
+		} else if errors.Is(result.err, api.ErrForbidden) {
+			fmt.Printf("🚫 not allowed to pull page %q\n", id)
+			i++
+		} else if result.err != nil {
+			fmt.Printf("❌ could not pull page: %q: %v\n", id, result.err)
 			i++
 		}
-		if pulled {
+		if result.pulled {
 			fmt.Printf("⬇️  pulled page %q\n", id)
 			i++
 		}
+	})
+	// results are saved before prompting, so that they are kept if user aborts
+	SaveDatabase(database)
+	for _, id := range deleted {
+		deletedRemotely(database, id)
 	}
-	if i == 0 {
+	if rejected {
+		unauthorized(ctx, database, client)
+	} else if i == 0 && ctx.Err() == nil {
 		fmt.Println("✅ all tracked pages are already up to date")
 	}
 
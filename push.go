@@ -1,40 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"maps"
-	"slices"
 
 	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Push(args []string) {
+func Push(ctx context.Context, args []string) {
 	database := LoadDatabase()
-	token := LoadToken()
+	client := newClient(database)
 
-	client := api.NewClient(database.Config.BaseURL)
-	client.Token = token
-
-	var pages []string
-	if len(args) > 0 {
-		pages = args
-	} else {
-		pages = slices.Collect(maps.Keys(database.Pages))
+	type pushResult struct {
+		pushed bool
+		err    error
 	}
+
+	pages := selectPages(database, args)
 	var i int
-	for _, id := range pages {
-		pushed, err := database.pushPage(client, id, force)
-		if err != nil {
-			fmt.Printf("❌ could not push page: %q %v\n", id, err)
+	var rejected bool // authentication token rejected by server
+	processPages(ctx, pages, func(id string) pushResult {
+		pushed, err := database.pushPage(ctx, client, id, force)
+		return pushResult{pushed, err}
+	}, func(id string, result pushResult) {
+		if errors.Is(result.err, api.ErrNotFound) {
+			fmt.Printf("🗑️  page %q was deleted on server, run 'wsync remove %s' to untrack it\n", id, id)
+			i++
+		} else if errors.Is(result.err, api.ErrUnauthorized) {
+			rejected = true
+			i++
+		} else if errors.Is(result.err, api.ErrForbidden) {
+			fmt.Printf("🚫 not allowed to push page %q\n", id)
+			i++
+		} else if result.err != nil {
+			fmt.Printf("❌ could not push page: %q %v\n", id, result.err)
 			i++
 		}
-		if pushed {
+		if result.pushed {
 			fmt.Printf("⬆️  pushed page %q - ", id)
 			fmt.Print(database.Config.BaseURL + "/" + id + "\n")
 			i++
 		}
-	}
-	if i == 0 {
+	})
+	if rejected {
+		unauthorized(ctx, database, client)
+	} else if i == 0 && ctx.Err() == nil {
 		fmt.Println("✅ all tracked pages are already up to date")
 	}
 	SaveDatabase(database)
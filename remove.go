@@ -1,25 +1,81 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+
+	"github.com/charmbracelet/huh"
+	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Remove(args []string) {
-	if len(args) < 1 {
+func Remove(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("remove", flag.ExitOnError)
+	remote := flags.Bool("remote", false, "also delete pages on the server")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
 		log.Fatalln("remove sub-command need at least one page id argument")
 	}
+	ids := flags.Args()
 
 	database := LoadDatabase()
 
-	for _, id := range args {
+	var client *api.Client
+	if *remote {
+		client = newClient(database)
+
+		if interactive {
+			var confirm bool
+			confirmForm := huh.NewForm(
+				huh.NewGroup(
+					huh.NewConfirm().
+						Title(fmt.Sprintln("delete", len(ids), "pages on the server ?")).
+						Description(fmt.Sprintln(ids, "⚠️  this cannot be undone")).
+						Value(&confirm),
+				),
+			)
+			if err := confirmForm.Run(); err != nil {
+				log.Fatal(err)
+			}
+			if !confirm {
+				log.Fatalln("❌ remove aborted")
+			}
+		}
+	}
+
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			fmt.Printf("🛑 interrupted, %d page(s) were not processed\n", len(ids)-i)
+			break
+		}
+		if *remote {
+			deleted, err := database.deleteRemotePage(ctx, client, id, force)
+			if errors.Is(err, api.ErrUnauthorized) {
+				unauthorized(ctx, database, client)
+				break
+			} else if errors.Is(err, api.ErrForbidden) {
+				fmt.Printf("🚫 not allowed to delete page %q on server\n", id)
+				continue
+			} else if err != nil {
+				fmt.Printf("❌ error while deleting %q on server: %v\n", id, err)
+				continue
+			}
+			if deleted {
+				fmt.Printf("💥 deleted page %q on server\n", id)
+			} else {
+				fmt.Printf("🗑️  page %q was already deleted on server\n", id)
+			}
+		}
+
+		path := database.pagePath(id)
 		fileDeleted, err := database.removePage(id)
 		if err != nil {
 			fmt.Printf("❌ error while removing %q: %v\n", id, err)
-		} else if fileDeleted {
-			fmt.Printf("🗑️  removed page %q and deleted local associated file\n", id)
 		} else {
-			fmt.Printf("🛡️  untracked page %q, but kept %q file because of local modifications\n", id, GetPagePath(id))
+			printRemoved(id, path, fileDeleted)
 		}
 	}
 
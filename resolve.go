@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+func Resolve(args []string) {
+	if len(args) < 1 {
+		log.Fatalln("resolve sub-command need at least one page id argument")
+	}
+
+	database := LoadDatabase()
+
+	for _, id := range args {
+		err := database.resolvePage(id)
+		if err != nil {
+			fmt.Printf("❌ could not resolve conflict of page %q: %v\n", id, err)
+		} else {
+			fmt.Printf("🤝 conflict of page %q resolved, it will be pushed on next push or sync\n", id)
+		}
+	}
+
+	SaveDatabase(database)
+}
@@ -1,14 +1,46 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Status() {
+type pageStatus struct {
+	ID          string    `json:"id"`
+	State       PageState `json:"state"`
+	RenamedFrom string    `json:"renamedfrom,omitempty"` // untracked file looks like a renamed tracked page
+}
+
+// human readable labels of each state, in display order
+var stateLabels = []struct {
+	state PageState
+	emoji string
+	label string
+}{
+	{StateModified, "✏️ ", "localy edited page(s), ahead of server"},
+	{StateBehind, "⬇️ ", "page(s) edited on server, behind server"},
+	{StateDiverged, "🔀", "page(s) edited on both sides, diverged"},
+	{StateConflict, "⚔️ ", "conflicted page(s), waiting to be resolved"},
+	{StateDeletedLocally, "🕳️ ", "page(s) deleted locally"},
+	{StateDeletedRemotely, "🗑️ ", "page(s) deleted on server"},
+	{StateUntracked, "❔", "untracked file(s)"},
+}
+
+func Status(args []string) {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "print status as JSON")
+	porcelain := flags.Bool("porcelain", false, "print one 'STATE PAGE_ID' line per page")
+	flags.Parse(args)
+
 	files, err := os.ReadDir(repoPath)
 	if err != nil {
 		log.Fatalln("could not read folder:", err)
@@ -16,30 +48,146 @@ func Status() {
 
 	database := LoadDatabase()
 
-	var untrackedFiles []string
-	var trackedFiles []string
-	var trackedModifiedFiles []string
+	var statuses []pageStatus
+	for _, id := range database.ids() {
+		state, err := database.State(id)
+		if err != nil {
+			log.Fatalln("error:", err)
+		}
+		statuses = append(statuses, pageStatus{ID: id, State: state})
+	}
 	for _, file := range files {
 		if !file.IsDir() && filepath.Ext(file.Name()) == ".md" {
 			id := strings.TrimSuffix(file.Name(), ".md")
-			_, exist := database.Pages[id]
-			if !exist {
-				untrackedFiles = append(untrackedFiles, id)
+			if _, exist := database.page(id); !exist {
+				statuses = append(statuses, pageStatus{ID: id, State: StateUntracked})
+			}
+		}
+	}
+	statuses = detectRenames(database, statuses)
+	slices.SortFunc(statuses, func(a, b pageStatus) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	switch {
+	case *jsonOutput:
+		output := struct {
+			DateFetch *time.Time   `json:"datefetch"`
+			Pages     []pageStatus `json:"pages"`
+		}{
+			Pages: statuses,
+		}
+		if !database.DateFetch.IsZero() {
+			output.DateFetch = &database.DateFetch
+		}
+		if output.Pages == nil {
+			output.Pages = []pageStatus{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(output); err != nil {
+			log.Fatalln("encode status:", err)
+		}
+	case *porcelain:
+		for _, status := range statuses {
+			if status.RenamedFrom != "" {
+				fmt.Println(status.State, status.ID, status.RenamedFrom)
 			} else {
-				trackedFiles = append(trackedFiles, id)
-				modified, err := database.HasBeenModified(id)
-				if err != nil {
-					log.Fatalln("error:", err)
+				fmt.Println(status.State, status.ID)
+			}
+		}
+	default:
+		printStatus(database, statuses)
+	}
+}
+
+func printStatus(database *Database, statuses []pageStatus) {
+	byState := make(map[PageState][]string)
+	var tracked int
+	for _, status := range statuses {
+		byState[status.State] = append(byState[status.State], status.ID)
+		if status.State != StateUntracked {
+			tracked++
+		}
+	}
+
+	fmt.Println("📦️ Repo contains", tracked, "tracked page(s)")
+	fmt.Println("  ↳ including", len(byState[StateUpToDate]), "up to date page(s)")
+	for _, stateLabel := range stateLabels {
+		ids := byState[stateLabel.state]
+		if len(ids) > 0 {
+			fmt.Println(stateLabel.emoji, len(ids), stateLabel.label, ids)
+		}
+	}
+
+	for _, status := range statuses {
+		if status.RenamedFrom != "" {
+			path := localPath(status.ID, database.layout(status.RenamedFrom))
+			fmt.Printf("🚚 %q looks like %q renamed, run 'wsync mv %s %s' to rename the page\n", path, status.RenamedFrom, status.RenamedFrom, status.ID)
+		}
+	}
+
+	if database.DateFetch.IsZero() {
+		fmt.Println("💡 server state is unknown, run 'wsync fetch' to compare with server")
+	} else {
+		fmt.Println("📡 server state as of last fetch:", database.DateFetch.Format(time.DateTime))
+	}
+}
+
+// Find untracked files with the same content as the last synced version of a page deleted locally.
+// Those are probably renamed pages. Candidates are read with the layout of the deleted page,
+// and untracked directories are considered too for pages stored as directories.
+func detectRenames(database *Database, statuses []pageStatus) []pageStatus {
+	var deleted []string
+	for _, status := range statuses {
+		if status.State == StateDeletedLocally {
+			if pageData, _ := database.page(status.ID); pageData.Hash != "" {
+				deleted = append(deleted, status.ID)
+			}
+		}
+	}
+	if len(deleted) == 0 {
+		return statuses
+	}
+
+	var candidates []int // indexes of untracked statuses
+	for i, status := range statuses {
+		if status.State == StateUntracked {
+			candidates = append(candidates, i)
+		}
+	}
+	var directories []string
+	if files, err := os.ReadDir(repoPath); err == nil {
+		for _, file := range files {
+			id := file.Name()
+			if _, exist := database.page(id); !exist && file.IsDir() && api.ValidateID(id) == nil {
+				directories = append(directories, id)
+			}
+		}
+	}
+
+	for _, oldID := range deleted {
+		pageData, _ := database.page(oldID)
+		l := pageData.layout()
+		if l.directory {
+			for _, id := range directories {
+				if _, err := os.Stat(filepath.Join(GetPageDir(id), "main.md")); err != nil {
+					continue
 				}
-				if modified {
-					trackedModifiedFiles = append(trackedModifiedFiles, id)
+				if content, err := readLocal(id, l); err == nil && hashContent(content) == pageData.Hash {
+					statuses = append(statuses, pageStatus{ID: id, State: StateUntracked, RenamedFrom: oldID})
 				}
 			}
+			continue
+		}
+		for _, i := range candidates {
+			if statuses[i].RenamedFrom != "" {
+				continue
+			}
+			if content, err := readLocal(statuses[i].ID, l); err == nil && hashContent(content) == pageData.Hash {
+				statuses[i].RenamedFrom = oldID
+			}
 		}
 	}
-	fmt.Println("📦️ Repo contains:")
-	fmt.Println(len(trackedFiles), "tracked file(s)", trackedFiles)
-	fmt.Println("  ↳ including", len(trackedModifiedFiles), "localy edited file(s)", trackedModifiedFiles)
-	fmt.Println(len(untrackedFiles), "untracked file(s)", untrackedFiles)
-
+	return statuses
 }
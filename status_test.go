@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDetectRenames(t *testing.T) {
+	tests := []struct {
+		name string
+		l    layout
+	}{
+		{"single file", layout{}},
+		{"sidecars", layout{sidecars: true}},
+		{"directory", layout{directory: true}},
+		{"directory and sidecars", layout{directory: true, sidecars: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repoPath = t.TempDir()
+			contents := map[string]string{"main": "text", "header": "header", "css": "body {}"}
+			content := joinParts(test.l.parts("old"), contents)
+			if !test.l.joined() {
+				content = "text"
+			}
+			if err := writeLocal("new", test.l, content); err != nil {
+				t.Fatal(err)
+			}
+
+			db := NewDatabase()
+			db.setPage("old", &PageData{Hash: hashContent(content), Directory: test.l.directory, Sidecars: test.l.sidecars})
+			statuses := []pageStatus{{ID: "old", State: StateDeletedLocally}}
+			if !test.l.directory {
+				statuses = append(statuses, pageStatus{ID: "new", State: StateUntracked})
+			}
+
+			statuses = detectRenames(db, statuses)
+			var renamedFrom string
+			for _, status := range statuses {
+				if status.ID == "new" {
+					renamedFrom = status.RenamedFrom
+				}
+			}
+			if renamedFrom != "old" {
+				t.Errorf("rename not detected: %+v", statuses)
+			}
+		})
+	}
+}
@@ -1,43 +1,106 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"maps"
-	"slices"
 
 	"github.com/vincent-peugnet/wsync/api"
 )
 
-func Sync(args []string) {
+func Sync(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	propagateDeletes := flags.Bool("propagate-deletes", false, "delete on the server pages whose local file was deleted")
+	flags.Parse(args)
+
 	database := LoadDatabase()
-	token := LoadToken()
+	client := newClient(database)
 
-	client := api.NewClient(database.Config.BaseURL)
-	client.Token = token
+	type syncResult struct {
+		action  syncAction
+		err     error
+		markErr error // error while writing conflict markers
+	}
 
-	var pages []string
-	if len(args) > 0 {
-		pages = args
-	} else {
-		pages = slices.Collect(maps.Keys(database.Pages))
+	pages := selectPages(database, flags.Args())
+	remotelyModified, err := database.remotelyModified(ctx, client, pages)
+	if errors.Is(err, api.ErrUnauthorized) {
+		fatalRequest(ctx, database, client, err)
+	} else if err != nil {
+		fmt.Printf("⚠️  %v, checking pages one by one\n", err)
 	}
+
+	var conflicts []string // interactive conflicts, prompted once all pages are processed
+	var deleted []string   // pages deleted on server, prompted once all pages are processed
 	var i int
-	for _, id := range pages {
-		synced, err := database.syncPage(client, id)
-		if interactive && errors.Is(err, api.ErrConflict) {
-			conflict(database, client, id)
+	var rejected bool // authentication token rejected by server
+	processPages(ctx, pages, func(id string) syncResult {
+		options := syncOptions{
+			checkRemote:      remotelyModified == nil || remotelyModified[id],
+			propagateDeletes: *propagateDeletes,
+		}
+		action, err := database.syncPage(ctx, client, id, options)
+		if !interactive && errors.Is(err, api.ErrConflict) {
+			return syncResult{action, err, database.markConflict(ctx, client, id)}
+		}
+		return syncResult{action, err, nil}
+	}, func(id string, result syncResult) {
+		if interactive && errors.Is(result.err, api.ErrNotFound) {
+			deleted = append(deleted, id)
+			i++
+		} else if errors.Is(result.err, api.ErrNotFound) {
+			fmt.Printf("🗑️  page %q was deleted on server, run 'wsync remove %s' to untrack it\n", id, id)
+			i++
+		} else if interactive && errors.Is(result.err, api.ErrConflict) {
+			conflicts = append(conflicts, id)
+			i++
+		} else if errors.Is(result.err, api.ErrConflict) {
+			if result.markErr != nil {
+				fmt.Printf("❌ could not sync page %q: %v\n", id, result.markErr)
+			} else {
+				fmt.Printf("⚔️  conflict for page %q: markers written in %s, fix the file then run 'wsync resolve %s'\n", id, quoteList(database.conflictedPaths(id)), id)
+			}
+			i++
+		} else if errors.Is(result.err, api.ErrUnauthorized) {
+			rejected = true
 			i++
-		} else if err != nil {
-			fmt.Printf("❌ could not sync page %q: %v\n", id, err)
+		} else if errors.Is(result.err, api.ErrForbidden) {
+			fmt.Printf("🚫 not allowed to sync page %q\n", id)
 			i++
-		} else if synced {
+		} else if result.err != nil {
+			fmt.Printf("❌ could not sync page %q: %v\n", id, result.err)
+			i++
+		} else if result.action == syncRestored {
+			fmt.Printf("♻️  restored deleted file %q from server\n", database.pagePath(id))
+			i++
+		} else if result.action == syncDeleted {
+			fmt.Printf("💥 deleted page %q on server, as its local file was deleted\n", id)
+			i++
+		} else if result.action == syncMerged {
+			fmt.Printf("🔀 merged local and server versions of page %q ", id)
+			fmt.Print(database.Config.BaseURL + "/" + id + "\n")
+			i++
+		} else if result.action != syncNone {
 			fmt.Printf("🔃 synced page %q ", id)
 			fmt.Print(database.Config.BaseURL + "/" + id + "\n")
 			i++
 		}
+	})
+	// results are saved before prompting, so that they are kept if user aborts
+	SaveDatabase(database)
+	for _, id := range conflicts {
+		if ctx.Err() != nil {
+			break // interrupted
+		}
+		conflict(ctx, database, client, id)
+	}
+	for _, id := range deleted {
+		deletedRemotely(database, id)
 	}
-	if i == 0 {
+	if rejected {
+		unauthorized(ctx, database, client)
+	} else if i == 0 && ctx.Err() == nil {
 		fmt.Println("✅ all tracked pages are already in sync")
 	}
 	SaveDatabase(database)
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var (
+	viewerTitleStyle   = lipgloss.NewStyle().Bold(true)
+	viewerHelpStyle    = lipgloss.NewStyle().Faint(true)
+	viewerDeleteStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	viewerInsertStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	viewerHunkStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+	viewerDividerStyle = lipgloss.NewStyle().Faint(true)
+)
+
+// scrollable view comparing local and server versions of a page
+type diffViewer struct {
+	id         string
+	local      string
+	server     string
+	sideBySide bool
+	ready      bool
+	viewport   viewport.Model
+}
+
+// open the diff viewer in full screen, return when user quits
+func showDiff(id, local, server string) error {
+	viewer := diffViewer{
+		id:         id,
+		local:      local,
+		server:     server,
+		sideBySide: true,
+	}
+	_, err := tea.NewProgram(viewer, tea.WithAltScreen(), tea.WithMouseCellMotion()).Run()
+	return err
+}
+
+func (v diffViewer) Init() tea.Cmd {
+	return nil
+}
+
+func (v diffViewer) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return v, tea.Quit
+		case "tab":
+			v.sideBySide = !v.sideBySide
+			v.viewport.SetContent(v.render())
+			v.viewport.GotoTop()
+			return v, nil
+		}
+	case tea.WindowSizeMsg:
+		height := msg.Height - lipgloss.Height(v.header()) - lipgloss.Height(v.footer())
+		if !v.ready {
+			v.viewport = viewport.New(msg.Width, height)
+			v.ready = true
+		} else {
+			v.viewport.Width = msg.Width
+			v.viewport.Height = height
+		}
+		v.viewport.SetContent(v.render())
+	}
+
+	var cmd tea.Cmd
+	v.viewport, cmd = v.viewport.Update(msg)
+	return v, cmd
+}
+
+func (v diffViewer) View() string {
+	if !v.ready {
+		return ""
+	}
+	return v.header() + "\n" + v.viewport.View() + "\n" + v.footer()
+}
+
+func (v diffViewer) header() string {
+	mode := "unified"
+	if v.sideBySide {
+		mode = "side by side"
+	}
+	return viewerTitleStyle.Render(fmt.Sprintf("%s: local ↔ server (%s)", v.id, mode))
+}
+
+func (v diffViewer) footer() string {
+	return viewerHelpStyle.Render(fmt.Sprintf("%3.f%% • ↑/↓ scroll • tab switch view • q back", v.viewport.ScrollPercent()*100))
+}
+
+func (v diffViewer) render() string {
+	if v.sideBySide {
+		return renderSideBySide(v.local, v.server, v.viewport.Width)
+	}
+	return renderUnified(unifiedDiff("server/"+v.id, "local/"+v.id, v.server, v.local))
+}
+
+func renderUnified(diff string) string {
+	if diff == "" {
+		return "versions are identical"
+	}
+	var sb strings.Builder
+	for _, line := range splitLines(diff) {
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			line = viewerTitleStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			line = viewerHunkStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = viewerDeleteStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			line = viewerInsertStyle.Render(line)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// render local version on the left and server version on the right, aligning unchanged lines
+func renderSideBySide(local, server string, width int) string {
+	a := splitLines(local)
+	b := splitLines(server)
+	columnWidth := max((width-3)/2, 1)
+
+	cell := func(line string, style *lipgloss.Style) string {
+		line = strings.TrimRight(line, "\r\n")
+		line = strings.ReplaceAll(line, "\t", "    ")
+		line = ansi.Truncate(line, columnWidth, "…")
+		line += strings.Repeat(" ", columnWidth-ansi.StringWidth(line))
+		if style != nil {
+			return style.Render(line)
+		}
+		return line
+	}
+
+	var sb strings.Builder
+	sb.WriteString(cell("local", &viewerTitleStyle) + viewerDividerStyle.Render(" │ ") + cell("server", &viewerTitleStyle) + "\n")
+
+	// lines only present on one side, colored like in unified view
+	var localOnly, serverOnly []string
+	flush := func() {
+		for i := range max(len(localOnly), len(serverOnly)) {
+			left, right := cell("", nil), cell("", nil)
+			if i < len(localOnly) {
+				left = cell(localOnly[i], &viewerInsertStyle)
+			}
+			if i < len(serverOnly) {
+				right = cell(serverOnly[i], &viewerDeleteStyle)
+			}
+			sb.WriteString(left + viewerDividerStyle.Render(" │ ") + right + "\n")
+		}
+		localOnly, serverOnly = nil, nil
+	}
+
+	for _, e := range diffLines(a, b) {
+		switch e.Op {
+		case opEqual:
+			flush()
+			sb.WriteString(cell(a[e.A], nil) + viewerDividerStyle.Render(" │ ") + cell(b[e.B], nil) + "\n")
+		case opDelete:
+			localOnly = append(localOnly, a[e.A])
+		case opInsert:
+			serverOnly = append(serverOnly, b[e.B])
+		}
+	}
+	flush()
+
+	return sb.String()
+}